@@ -0,0 +1,90 @@
+package main
+
+import "strings"
+
+// attachComments turns lines into items where each comment line is attached
+// to the next line that is not a comment, so the comment moves with it. If
+// --attach-blank-lines was given, blank lines are attached the same way.
+// Otherwise, blank lines and the comments directly above them stay where
+// they are. The sort keys and uniqueness only look at the line that is not a
+// comment.
+//
+// Comments at the end of the file, with no line after them, stay at the end.
+func (o *omegasort) attachComments(lines []string) *document {
+	doc := &document{}
+	le := string(o.lineEnding)
+
+	var pending []string
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" && !o.opts.attachBlank {
+			doc.addFixed(append(pending, l))
+			pending = nil
+			continue
+		}
+		if o.isAttached(l) {
+			pending = append(pending, l)
+			continue
+		}
+
+		doc.items = append(doc.items, item{
+			text:  strings.Join(append(pending, l), le),
+			value: l,
+			line:  i + 1,
+		})
+		pending = nil
+	}
+	doc.footer = pending
+
+	return doc
+}
+
+func (o *omegasort) isAttached(l string) bool {
+	trimmed := strings.TrimSpace(l)
+	if trimmed == "" {
+		return o.opts.attachBlank
+	}
+	return strings.HasPrefix(trimmed, o.opts.commentPrefix)
+}
+
+// moveLeadingBlankLines stops the blank lines attached to an item from
+// ending up at the top of the file when that item is sorted first. Instead,
+// they're swapped with the blank lines of the item which came first in the
+// file before sorting, which usually has none. This is done after any
+// duplicates are removed, so that the blank lines are never moved to an item
+// which is then removed.
+func (o *omegasort) moveLeadingBlankLines(items []item) {
+	first := 0
+	for i, it := range items {
+		if it.line < items[first].line {
+			first = i
+		}
+	}
+	if first == 0 {
+		return
+	}
+
+	le := string(o.lineEnding)
+	blank, rest := splitLeadingBlankLines(items[0].text, le)
+	if blank == "" {
+		return
+	}
+
+	firstBlank, firstRest := splitLeadingBlankLines(items[first].text, le)
+	items[first].text = blank + firstRest
+	items[0].text = firstBlank + rest
+}
+
+// splitLeadingBlankLines splits text into its leading blank lines, including
+// their line endings, and the rest of the text.
+func splitLeadingBlankLines(text, le string) (string, string) {
+	lines := strings.Split(text, le)
+	n := 0
+	for n < len(lines)-1 && strings.TrimSpace(lines[n]) == "" {
+		n++
+	}
+	if n == 0 {
+		return "", text
+	}
+
+	return strings.Join(lines[:n], le) + le, strings.Join(lines[n:], le)
+}
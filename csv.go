@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+func (o *omegasort) isCSV() bool {
+	return o.opts.format == "csv" || o.opts.format == "tsv"
+}
+
+func (o *omegasort) csvDelimiter() rune {
+	if o.opts.format == "tsv" {
+		return '\t'
+	}
+	return ','
+}
+
+// readCSV parses the file as CSV (or TSV). The first record is the header,
+// which is never sorted. Each item is a single record, which may span more
+// than one line if it contains quoted newlines.
+//
+// We keep the original text of each record rather than writing the records
+// back out with a csv.Writer so that quoting in the file is preserved.
+func (o *omegasort) readCSV() (*document, error) {
+	err := o.determineLineEnding()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(o.opts.file)
+	if err != nil {
+		return nil, err
+	}
+
+	// The csv package only knows about LF and CRLF line endings, so a file
+	// with CR line endings would be read as a single record. We turn those
+	// into LF for parsing and turn them back when we get each record's text.
+	crOnly := bytes.Equal(o.lineEnding, cr)
+	if crOnly {
+		content = bytes.ReplaceAll(content, cr, nl)
+	}
+
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = o.csvDelimiter()
+	if o.opts.format == "tsv" {
+		// TSV files generally don't quote fields, so a quote in a field
+		// should just be a quote.
+		r.LazyQuotes = true
+	}
+
+	var records [][]string
+	var starts []int
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+		records = append(records, record)
+		starts = append(starts, line)
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("the file does not contain a header row")
+	}
+
+	if err := o.resolveKeyColumns(records[0]); err != nil {
+		return nil, err
+	}
+
+	// The csv package counts lines by newlines, so we split the same way.
+	lines := strings.SplitAfter(string(content), "\n")
+	rawRecord := func(i int) string {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+		// This strips the final line ending, as well as any blank lines
+		// between this record and the next. The csv package ignores those
+		// lines, and so do we.
+		text := strings.TrimRight(strings.Join(lines[starts[i]-1:end], ""), "\r\n")
+		if crOnly {
+			text = strings.ReplaceAll(text, "\n", "\r")
+		}
+		return text
+	}
+
+	doc := &document{
+		header: []string{rawRecord(0)},
+		items:  make([]item, len(records)-1),
+	}
+	for i, record := range records[1:] {
+		doc.items[i] = item{
+			text:   rawRecord(i + 1),
+			value:  strings.Join(record, string(r.Comma)),
+			fields: record,
+			line:   starts[i+1],
+		}
+	}
+
+	return doc, nil
+}
+
+// resolveKeyColumns turns the column names given in --key flags into field
+// numbers.
+func (o *omegasort) resolveKeyColumns(header []string) error {
+	for idx, name := range o.keyColumns {
+		found := false
+		for i, h := range header {
+			if h == name {
+				o.keys[idx].Field = i + 1
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("the key column %q is not in the header row", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/houseabsolute/omegasort/internal/sorters"
+)
+
+var dateOrders = map[string]sorters.DateOrder{
+	"strict":      sorters.DateOrderStrict,
+	"month-first": sorters.MonthFirst,
+	"day-first":   sorters.DayFirst,
+}
+
+// validateDatetime checks the --datetime-format, --timezone, and
+// --date-order flags and turns the formats and time zone into the values
+// that the datetime-text approach uses.
+func (o *omegasort) validateDatetime() error {
+	if o.opts.sort != "" && o.sort.Name != "datetime-text" {
+		switch {
+		case len(o.opts.datetimeFormats) > 0:
+			return fmt.Errorf("you cannot pass the --datetime-format flag when sorting by %s", o.sort.Name)
+		case o.opts.timezone != "":
+			return fmt.Errorf("you cannot pass the --timezone flag when sorting by %s", o.sort.Name)
+		case o.opts.dateOrder != "strict":
+			return fmt.Errorf("you cannot pass the --date-order flag when sorting by %s", o.sort.Name)
+		}
+	}
+
+	for _, f := range o.opts.datetimeFormats {
+		layout, err := sorters.DatetimeLayout(f)
+		if err != nil {
+			return err
+		}
+		o.datetimeLayouts = append(o.datetimeLayouts, layout)
+	}
+
+	if o.opts.timezone != "" {
+		loc, err := sorters.ParseTimezone(o.opts.timezone)
+		if err != nil {
+			return err
+		}
+		o.location = loc
+	}
+
+	return nil
+}
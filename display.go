@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type notCanonicalError struct {
+	line      int
+	content   string
+	canonical string
+}
+
+func (nce notCanonicalError) Error() string {
+	return fmt.Sprintf("line %d - %s should be written as %s", nce.line, nce.content, nce.canonical)
+}
+
+// validateDisplay checks that --display or --canonicalize can be used with
+// the other flags. Lines can only be rewritten when the whole line is the
+// value being sorted.
+func (o *omegasort) validateDisplay() error {
+	flag := "--display"
+	if o.opts.canonicalize {
+		if o.opts.display == "original" {
+			return errors.New("you cannot use --canonicalize with --display original")
+		}
+		o.opts.display = "canonical"
+		flag = "--canonicalize"
+	}
+
+	if o.opts.display == "" {
+		return nil
+	}
+
+	if o.opts.sort == "" {
+		return fmt.Errorf("you can only use %s with --sort", flag)
+	}
+	if o.sort.Canonicalize == nil {
+		return fmt.Errorf("you cannot use %s when sorting by %s", flag, o.sort.Name)
+	}
+	if !o.wholeLineIsValue() {
+		return fmt.Errorf("you cannot use %s with --key, --key-regex, --records, or --record-start", flag)
+	}
+	if o.opts.format != "lines" {
+		return fmt.Errorf("you cannot use %s with --format %s", flag, o.opts.format)
+	}
+
+	return nil
+}
+
+func (o *omegasort) wholeLineIsValue() bool {
+	return len(o.opts.keys) == 0 && o.opts.keyRegex == "" && o.opts.records == "lines" && o.opts.recordStart == ""
+}
+
+// displaysCanonical returns true if each value should be rewritten in its
+// canonical form. The ip-or-network approach does this unless you pass
+// "--display original", while other approaches only do it if you pass
+// "--display canonical".
+func (o *omegasort) displaysCanonical() bool {
+	switch o.opts.display {
+	case "canonical":
+		return true
+	case "original":
+		return false
+	}
+
+	return o.opts.sort == "ip-or-network" && o.opts.format == "lines" && o.wholeLineIsValue()
+}
+
+// canonicalize rewrites the value in each item in its canonical form. Any
+// comments attached to an item are kept.
+func (o *omegasort) canonicalize(items []item) error {
+	for i, it := range items {
+		canonical, err := o.sort.Canonicalize(it.value)
+		if err != nil {
+			return err
+		}
+		items[i].text = strings.TrimSuffix(it.text, it.value) + canonical
+		items[i].value = canonical
+	}
+
+	return nil
+}
+
+// checkCanonical returns an error for the first item whose value is not in
+// its canonical form.
+func (o *omegasort) checkCanonical(items []item) error {
+	for _, it := range items {
+		canonical, err := o.sort.Canonicalize(it.value)
+		if err != nil {
+			return err
+		}
+		if canonical != it.value {
+			return notCanonicalError{line: it.line, content: it.value, canonical: canonical}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// readGroups splits lines into groups separated by blank lines, so that each
+// group can be sorted on its own. If --comment-prefix was given, the comment
+// lines at the start of a group are its heading, and they stay at the top of
+// the group. Any other comments are attached to the line after them.
+//
+// The blank lines after each group are that group's footer, and any blank
+// lines before the first group are the document's header.
+func (o *omegasort) readGroups(lines []string) *document {
+	doc := &document{}
+
+	var group []string
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+			if group == nil {
+				start = i
+			}
+			group = append(group, lines[i])
+			continue
+		}
+
+		if group != nil {
+			doc.groups = append(doc.groups, o.readGroup(group, start))
+			group = nil
+		}
+		if i == len(lines) {
+			break
+		}
+
+		if len(doc.groups) == 0 {
+			doc.header = append(doc.header, lines[i])
+		} else {
+			last := doc.groups[len(doc.groups)-1]
+			last.footer = append(last.footer, lines[i])
+		}
+	}
+
+	return doc
+}
+
+// readGroup turns the lines of one group into a document. The start is the
+// index of the group's first line in the file body.
+func (o *omegasort) readGroup(lines []string, start int) *document {
+	heading := 0
+	if o.opts.commentPrefix != "" {
+		for heading < len(lines) && o.isAttached(lines[heading]) {
+			heading++
+		}
+	}
+
+	var g *document
+	if o.opts.commentPrefix != "" {
+		g = o.attachComments(lines[heading:])
+	} else {
+		g = &document{items: make([]item, len(lines))}
+		for i, l := range lines {
+			g.items[i] = item{
+				text:  l,
+				value: l,
+				line:  i + 1,
+			}
+		}
+	}
+
+	g.header = append(lines[:heading:heading], g.header...)
+	for i := range g.items {
+		g.items[i].line += start + heading
+	}
+	// This is where the group starts, so we can name it in errors.
+	g.start = start + 1
+
+	return g
+}
+
+// sortable returns the documents whose items should be sorted. This is the
+// document's groups if it has any, and otherwise the document itself.
+func (d *document) sortable() []*document {
+	if len(d.groups) > 0 {
+		return d.groups
+	}
+	return []*document{d}
+}
+
+func (d *document) itemCount() int {
+	count := 0
+	for _, s := range d.sortable() {
+		count += len(s.items)
+	}
+	return count
+}
+
+// groupName returns a name for a group for use in error messages. This is
+// the group's heading if it has one.
+func (d *document) groupName() string {
+	if len(d.header) > 0 {
+		return fmt.Sprintf("%q", strings.TrimSpace(d.header[0]))
+	}
+	return fmt.Sprintf("starting at line %d", d.start)
+}
+
+type groupNotSortedError struct {
+	group string
+}
+
+func (gnse groupNotSortedError) Error() string {
+	return fmt.Sprintf("the group %s is not sorted", gnse.group)
+}
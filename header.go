@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// splitPinnedLines removes the lines which are never sorted from the start
+// and end of the file. These are the count line, the number of lines given
+// by --header-lines and --footer-lines, and any lines after the header which
+// match the --keep-leading regex.
+func (o *omegasort) splitPinnedLines(lines []string) (header, body, footer []string, err error) {
+	n := o.opts.headerLines
+	if o.opts.countLine {
+		n++
+	}
+	if n+o.opts.footerLines > len(lines) {
+		return nil, nil, nil, fmt.Errorf(
+			"the file has %d lines, which is fewer than the number of header and footer lines",
+			len(lines),
+		)
+	}
+
+	if o.opts.keepLeading != "" {
+		re, err := regexp.Compile(o.opts.keepLeading)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("the --keep-leading regex is invalid: %w", err)
+		}
+		for n < len(lines)-o.opts.footerLines && re.MatchString(lines[n]) {
+			n++
+		}
+	}
+
+	end := len(lines) - o.opts.footerLines
+	return lines[:n], lines[n:end], lines[end:], nil
+}
+
+// hasPinnedLines returns true if any of the flags for lines which are never
+// sorted were given.
+func (o *omegasort) hasPinnedLines() bool {
+	return o.opts.headerLines > 0 || o.opts.footerLines > 0 || o.opts.keepLeading != "" || o.opts.countLine
+}
+
+type wrongCountError struct {
+	count int
+	items int
+}
+
+func (wce wrongCountError) Error() string {
+	return fmt.Sprintf("the count on the first line is %d but the file has %d items", wce.count, wce.items)
+}
+
+// checkCount returns an error if the count on the first line of the file
+// doesn't match the number of items.
+func (o *omegasort) checkCount(doc *document) error {
+	count, err := strconv.Atoi(strings.TrimSpace(doc.header[0]))
+	if err != nil {
+		return fmt.Errorf("the first line of the file should be a count but it is %q", doc.header[0])
+	}
+	if items := doc.itemCount(); count != items {
+		return wrongCountError{count: count, items: items}
+	}
+
+	return nil
+}
+
+// updateCount sets the count on the first line of the file to the number of
+// items, which may have changed because of --unique. It returns true if the
+// count changed.
+func (o *omegasort) updateCount(doc *document) (bool, error) {
+	if _, err := strconv.Atoi(strings.TrimSpace(doc.header[0])); err != nil {
+		return false, fmt.Errorf("the first line of the file should be a count but it is %q", doc.header[0])
+	}
+
+	count := strconv.Itoa(doc.itemCount())
+	if doc.header[0] == count {
+		return false, nil
+	}
+	doc.header[0] = count
+
+	return true, nil
+}
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/houseabsolute/omegasort/internal/jsonpath"
+)
+
+// iniFile is an INI or TOML file split into sections. We don't fully parse
+// either format. We only need to know where each section and entry starts
+// and ends, so that we can move them around without changing their text.
+type iniFile struct {
+	// preamble contains the entries before the first section header. It is
+	// never moved.
+	preamble *iniSection
+	sections []*iniSection
+}
+
+type iniSection struct {
+	// header contains any comments directly above the section header,
+	// followed by the header itself. This is empty for the preamble.
+	header []string
+	name   string
+	// isArray is true for a TOML array of tables, like "[[products]]".
+	isArray bool
+	groups  []*iniGroup
+	// blank is the number of blank lines after the section.
+	blank int
+	// children contains the sub-tables of a TOML array of tables, like
+	// "[products.details]" after "[[products]]". These belong to the
+	// preceding array element, so they always move with it.
+	children []*iniSection
+}
+
+// iniGroup is a run of entries that isn't broken up by blank lines. Entries
+// are only sorted within their group, so blank-line grouping is kept.
+type iniGroup struct {
+	// blank is the number of blank lines before the group.
+	blank   int
+	entries []*iniEntry
+	// trailing contains any comments after the group's last entry.
+	trailing []string
+}
+
+type iniEntry struct {
+	// comments contains the comment lines directly above the entry.
+	comments []string
+	key      string
+	// lines contains the entry's key line along with any continuation lines.
+	lines []string
+	// line is the line number of the entry's key line.
+	line int
+}
+
+func (o *omegasort) runINI() error {
+	lines, err := o.readLines()
+	if err != nil {
+		return err
+	}
+
+	file, err := o.parseINI(lines)
+	if err != nil {
+		return err
+	}
+
+	before := file.lines()
+	if err := o.sortINI(file); err != nil {
+		return err
+	}
+
+	if o.opts.check {
+		return nil
+	}
+
+	after := file.lines()
+
+	return o.writeOutput(strings.Join(before, "\n") != strings.Join(after, "\n"), func(out io.Writer) error {
+		for _, l := range after {
+			if err := o.writeLine(out, l); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (o *omegasort) isCommentLine(trimmed string) bool {
+	if strings.HasPrefix(trimmed, "#") {
+		return true
+	}
+	return o.opts.format == "ini" && strings.HasPrefix(trimmed, ";")
+}
+
+func (o *omegasort) parseINI(lines []string) (*iniFile, error) {
+	file := &iniFile{preamble: &iniSection{}}
+	section := file.preamble
+	var group *iniGroup
+	var comments []string
+	blank := 0
+
+	// endGroup puts any comments we've seen at the end of the current group,
+	// since they're not attached to an entry.
+	endGroup := func() {
+		if len(comments) > 0 {
+			if group == nil {
+				group = &iniGroup{blank: blank}
+				section.groups = append(section.groups, group)
+				blank = 0
+			}
+			group.trailing = comments
+			comments = nil
+		}
+		group = nil
+	}
+
+	var lastArray *iniSection
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		trimmed := strings.TrimSpace(l)
+
+		switch {
+		case trimmed == "":
+			endGroup()
+			blank++
+		case o.isCommentLine(trimmed):
+			comments = append(comments, l)
+		case strings.HasPrefix(trimmed, "["):
+			// Comments directly above a header belong to the new section.
+			header := append(comments, l)
+			comments = nil
+			endGroup()
+			section.blank = blank
+			blank = 0
+
+			name, isArray, err := o.parseSectionHeader(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("%w on line %d", err, i+1)
+			}
+			section = &iniSection{
+				header:  header,
+				name:    name,
+				isArray: isArray,
+			}
+
+			switch {
+			case isArray:
+				lastArray = section
+				file.sections = append(file.sections, section)
+			case lastArray != nil && strings.HasPrefix(name, lastArray.name+"."):
+				lastArray.children = append(lastArray.children, section)
+			default:
+				lastArray = nil
+				file.sections = append(file.sections, section)
+			}
+		default:
+			if group == nil {
+				group = &iniGroup{blank: blank}
+				section.groups = append(section.groups, group)
+				blank = 0
+			}
+
+			entry := &iniEntry{
+				comments: comments,
+				key:      o.entryKey(l),
+				lines:    []string{l},
+				line:     i + 1,
+			}
+			comments = nil
+
+			end, err := o.entryEnd(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			entry.lines = append(entry.lines, lines[i+1:end+1]...)
+			i = end
+
+			group.entries = append(group.entries, entry)
+		}
+	}
+	endGroup()
+	section.blank = blank
+
+	return file, nil
+}
+
+func (o *omegasort) parseSectionHeader(trimmed string) (string, bool, error) {
+	header := trimmed
+	if o.opts.format == "toml" {
+		header = strings.TrimSpace(header[:scanTOML(header, nil)])
+	} else if i := strings.Index(header, "]"); i >= 0 {
+		// An INI section name can't contain "]", so anything after the
+		// first one is either a comment or an error.
+		rest := strings.TrimSpace(header[i+1:])
+		if rest == "" || o.isCommentLine(rest) {
+			header = header[:i+1]
+		}
+	}
+
+	isArray := o.opts.format == "toml" && strings.HasPrefix(header, "[[")
+	open, closing := "[", "]"
+	if isArray {
+		open, closing = "[[", "]]"
+	}
+	if !strings.HasSuffix(header, closing) || len(header) < len(open)+len(closing) {
+		return "", false, fmt.Errorf("invalid section header %q", trimmed)
+	}
+
+	name := strings.TrimSpace(header[len(open) : len(header)-len(closing)])
+	return name, isArray, nil
+}
+
+// entryKey returns the key for an entry. A line without a separator is an
+// entry with no value, which some INI files allow.
+func (o *omegasort) entryKey(l string) string {
+	if o.opts.format == "toml" {
+		if i := scanTOML(l, func(_ int, c byte) bool { return c != '=' }); i < len(l) && l[i] == '=' {
+			return strings.TrimSpace(l[:i])
+		}
+		return strings.TrimSpace(l)
+	}
+
+	if i := strings.IndexAny(l, "=:"); i >= 0 {
+		return strings.TrimSpace(l[:i])
+	}
+	return strings.TrimSpace(l)
+}
+
+// entryEnd returns the index of the last line of the entry starting at
+// lines[start]. In an INI file, lines after an entry which are indented more
+// than the entry's own line continue its value, like Python's configparser.
+// In a TOML file, a value can span lines if it is a multi-line string or
+// array.
+func (o *omegasort) entryEnd(lines []string, start int) (int, error) {
+	if o.opts.format == "ini" {
+		indent := indentWidth(lines[start])
+		end := start
+		for end+1 < len(lines) {
+			next := lines[end+1]
+			trimmed := strings.TrimSpace(next)
+			if trimmed == "" || o.isCommentLine(trimmed) || indentWidth(next) <= indent {
+				break
+			}
+			end++
+		}
+		return end, nil
+	}
+
+	value := tomlValue(lines[start])
+	for _, delim := range []string{`"""`, `'''`} {
+		if !strings.HasPrefix(value, delim) || strings.Contains(value[len(delim):], delim) {
+			continue
+		}
+		for end := start + 1; end < len(lines); end++ {
+			if strings.Contains(lines[end], delim) {
+				return end, nil
+			}
+		}
+		return 0, fmt.Errorf("the multi-line string on line %d is not closed", start+1)
+	}
+
+	if strings.HasPrefix(value, "[") {
+		depth := 0
+		for end := start; end < len(lines); end++ {
+			text := lines[end]
+			if end == start {
+				text = value
+			}
+			scanTOML(text, func(_ int, c byte) bool {
+				depth += bracketDepth(c)
+				return true
+			})
+			if depth <= 0 {
+				return end, nil
+			}
+		}
+		return 0, fmt.Errorf("the array on line %d is not closed", start+1)
+	}
+
+	return start, nil
+}
+
+// indentWidth returns the number of spaces and tabs at the start of a line.
+func indentWidth(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " \t"))
+}
+
+// tomlValue returns the trimmed text after the "=" in a key line.
+func tomlValue(l string) string {
+	i := scanTOML(l, func(_ int, c byte) bool { return c != '=' })
+	if i >= len(l) || l[i] != '=' {
+		return ""
+	}
+	return strings.TrimSpace(l[i+1:])
+}
+
+func bracketDepth(c byte) int {
+	switch c {
+	case '[', '{':
+		return 1
+	case ']', '}':
+		return -1
+	}
+	return 0
+}
+
+// scanTOML calls f with each byte in s that is not part of a string, until f
+// returns false or we reach a comment. It returns the index where it stopped,
+// which is len(s) if it reached the end. The f function may be nil.
+func scanTOML(s string, f func(i int, c byte) bool) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '#':
+			return i
+		case '"', '\'':
+			i = closingQuote(s, i)
+			continue
+		}
+		if f != nil && !f(i, c) {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// closingQuote returns the index of the quote that closes the string which
+// starts at s[start], or len(s) if the string is not closed.
+func closingQuote(s string, start int) int {
+	q := s[start]
+	for i := start + 1; i < len(s); i++ {
+		if q == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == q {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+func (o *omegasort) sortINI(file *iniFile) error {
+	paths := make([]jsonpath.Path, len(o.opts.paths))
+	found := make([]bool, len(o.opts.paths))
+	for i, expr := range o.opts.paths {
+		path, err := jsonpath.Parse(expr)
+		if err != nil {
+			return err
+		}
+		paths[i] = path
+	}
+
+	for _, section := range file.allSections() {
+		for _, group := range section.groups {
+			for _, entry := range group.entries {
+				parts := o.entryPathParts(section.name, entry.key)
+				for i, path := range paths {
+					if !entryMatchesPath(parts, path) {
+						continue
+					}
+					found[i] = true
+					if err := o.sortTOMLArray(path, entry); err != nil {
+						return err
+					}
+				}
+			}
+
+			if o.opts.sortAllKeys {
+				if err := o.sortINIGroup(group); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for i, path := range paths {
+		if !found[i] {
+			return fmt.Errorf("there is no value at %s", path)
+		}
+	}
+
+	if o.opts.sortSections {
+		return o.sortINISections(file)
+	}
+
+	return nil
+}
+
+func (f *iniFile) allSections() []*iniSection {
+	all := []*iniSection{f.preamble}
+	for _, s := range f.sections {
+		all = append(all, s)
+		all = append(all, s.children...)
+	}
+	return all
+}
+
+func (o *omegasort) sortINIGroup(group *iniGroup) error {
+	names := make([]string, len(group.entries))
+	for i, e := range group.entries {
+		names[i] = e.key
+	}
+
+	order, err := o.sortKeyNames(names)
+	if err != nil || order == nil {
+		return err
+	}
+
+	sorted := make([]*iniEntry, len(order))
+	for i, idx := range order {
+		sorted[i] = group.entries[idx]
+	}
+	group.entries = sorted
+
+	return nil
+}
+
+// sortINISections sorts the sections by name. The blank lines after each
+// section stay where they are, so that the file's last section doesn't end
+// up with no blank line after it.
+func (o *omegasort) sortINISections(file *iniFile) error {
+	names := make([]string, len(file.sections))
+	for i, s := range file.sections {
+		names[i] = s.name
+	}
+
+	order, err := o.sortKeyNames(names)
+	if err != nil || order == nil {
+		return err
+	}
+
+	sorted := make([]*iniSection, len(order))
+	for i, idx := range order {
+		sorted[i] = file.sections[idx]
+	}
+	blanks := make([]int, len(file.sections))
+	for i, s := range file.sections {
+		blanks[i] = s.lastBlank()
+	}
+	for i, s := range sorted {
+		s.setLastBlank(blanks[i])
+	}
+	file.sections = sorted
+
+	return nil
+}
+
+// lastBlank returns the number of blank lines after the section, including
+// any children it has.
+func (s *iniSection) lastBlank() int {
+	if len(s.children) > 0 {
+		return s.children[len(s.children)-1].blank
+	}
+	return s.blank
+}
+
+func (s *iniSection) setLastBlank(blank int) {
+	if len(s.children) > 0 {
+		s.children[len(s.children)-1].blank = blank
+		return
+	}
+	s.blank = blank
+}
+
+// entryPathParts returns the parts of the path to an entry's key in the given
+// section. For example, the key "include" in the "[tool]" section is at
+// "tool" and then "include". Keys in the preamble are at the top level. In a
+// TOML file a key can be dotted, like "tool.include", in which case it has
+// more than one part.
+func (o *omegasort) entryPathParts(section, key string) []string {
+	var parts []string
+	if section != "" {
+		parts = splitTOMLKey(section)
+	}
+	if o.opts.format == "toml" {
+		return append(parts, splitTOMLKey(key)...)
+	}
+	return append(parts, key)
+}
+
+// entryMatchesPath returns true if the path refers to the entry with the
+// given path parts. For example, the path ".tool.include" matches the parts
+// "tool" and "include".
+func entryMatchesPath(parts []string, path jsonpath.Path) bool {
+	segments := path.Segments()
+	if len(segments) != len(parts) {
+		return false
+	}
+	for i, seg := range segments {
+		if seg.IsIndex || (!seg.IsWildcard && seg.Key != parts[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitTOMLKey splits a dotted key like `tool."name.with.dots".include` into
+// its parts. Dots inside quoted parts don't split the key.
+func splitTOMLKey(k string) []string {
+	var parts []string
+	start := 0
+	end := scanTOML(k, func(i int, c byte) bool {
+		if c == '.' {
+			parts = append(parts, unquoteTOMLKey(k[start:i]))
+			start = i + 1
+		}
+		return true
+	})
+	return append(parts, unquoteTOMLKey(k[start:end]))
+}
+
+func unquoteTOMLKey(k string) string {
+	k = strings.TrimSpace(k)
+	if len(k) >= 2 && (k[0] == '"' || k[0] == '\'') && k[len(k)-1] == k[0] {
+		return k[1 : len(k)-1]
+	}
+	return k
+}
+
+// tomlElement is a single element of a TOML array.
+type tomlElement struct {
+	// comments contains any comment or blank lines directly above the
+	// element in a multi-line array.
+	comments []string
+	// indent is the whitespace before the element in a multi-line array.
+	indent string
+	text   string
+	// trailing contains any text after the element and its comma in a
+	// multi-line array, which will be a comment if it's not empty.
+	trailing string
+}
+
+// sortTOMLArray sorts the elements of the array in an entry. A single-line
+// array is written back on a single line. A multi-line array must have one
+// element per line, and each element keeps its comments when it moves.
+func (o *omegasort) sortTOMLArray(path jsonpath.Path, entry *iniEntry) error {
+	if !strings.HasPrefix(tomlValue(entry.lines[0]), "[") {
+		return fmt.Errorf("the value at %s on line %d is not an array", path, entry.line)
+	}
+
+	if len(entry.lines) == 1 {
+		return o.sortSingleLineArray(path, entry)
+	}
+	return o.sortMultiLineArray(path, entry)
+}
+
+func (o *omegasort) sortSingleLineArray(path jsonpath.Path, entry *iniEntry) error {
+	l := entry.lines[0]
+	eq := scanTOML(l, func(_ int, c byte) bool { return c != '=' })
+	open := eq + 1 + strings.Index(l[eq+1:], "[")
+
+	depth := 0
+	var commas []int
+	closing := scanTOML(l[open:], func(i int, c byte) bool {
+		depth += bracketDepth(c)
+		if c == ',' && depth == 1 {
+			commas = append(commas, open+i)
+		}
+		return depth > 0
+	}) + open
+
+	inner := l[open+1 : closing]
+	var elements []*tomlElement
+	start := open + 1
+	for _, end := range append(commas, closing) {
+		if text := strings.TrimSpace(l[start:end]); text != "" {
+			elements = append(elements, &tomlElement{text: text})
+		}
+		start = end + 1
+	}
+
+	sorted, changed, err := o.sortTOMLElements(path, elements)
+	if err != nil || !changed {
+		return err
+	}
+
+	texts := make([]string, len(sorted))
+	for i, e := range sorted {
+		texts[i] = e.text
+	}
+	pad := ""
+	if strings.HasPrefix(inner, " ") {
+		pad = " "
+	}
+	entry.lines[0] = l[:open+1] + pad + strings.Join(texts, ", ") + pad + l[closing:]
+
+	return nil
+}
+
+func (o *omegasort) sortMultiLineArray(path jsonpath.Path, entry *iniEntry) error {
+	last := len(entry.lines) - 1
+	if tomlValue(entry.lines[0]) != "[" || !strings.HasPrefix(strings.TrimSpace(entry.lines[last]), "]") {
+		return fmt.Errorf(
+			"the array at %s on line %d must have its opening and closing brackets on their own lines to be sorted",
+			path, entry.line,
+		)
+	}
+
+	var elements []*tomlElement
+	var comments []string
+	trailingComma := false
+	for i, l := range entry.lines[1:last] {
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			comments = append(comments, l)
+			continue
+		}
+
+		depth := 0
+		comma := -1
+		end := scanTOML(l, func(j int, c byte) bool {
+			depth += bracketDepth(c)
+			if c == ',' && depth == 0 {
+				if comma >= 0 {
+					return false
+				}
+				comma = j
+			}
+			return true
+		})
+		if depth != 0 || (end < len(l) && l[end] != '#') {
+			return fmt.Errorf("the array at %s must have one element per line to be sorted, but line %d does not", path, entry.line+i+1)
+		}
+
+		e := &tomlElement{
+			comments: comments,
+			indent:   l[:len(l)-len(strings.TrimLeft(l, " \t"))],
+		}
+		comments = nil
+		textEnd := end
+		trailingComma = comma >= 0
+		if trailingComma {
+			textEnd = comma
+		}
+		e.text = strings.TrimSpace(l[:textEnd])
+		e.trailing = strings.TrimRight(l[textEnd:], " \t")
+		if trailingComma {
+			e.trailing = strings.TrimPrefix(e.trailing, ",")
+		}
+		elements = append(elements, e)
+	}
+
+	sorted, changed, err := o.sortTOMLElements(path, elements)
+	if err != nil || !changed {
+		return err
+	}
+
+	lines := []string{entry.lines[0]}
+	for i, e := range sorted {
+		lines = append(lines, e.comments...)
+		comma := ","
+		if i == len(sorted)-1 && !trailingComma {
+			comma = ""
+		}
+		lines = append(lines, e.indent+e.text+comma+e.trailing)
+	}
+	lines = append(lines, comments...)
+	lines = append(lines, entry.lines[last])
+	entry.lines = lines
+
+	return nil
+}
+
+// sortTOMLElements sorts the array elements. Strings are sorted by their
+// unquoted value, and everything else is sorted by its text. This returns
+// false if the elements didn't change.
+func (o *omegasort) sortTOMLElements(path jsonpath.Path, elements []*tomlElement) ([]*tomlElement, bool, error) {
+	values := make([]string, len(elements))
+	for i, e := range elements {
+		b, err := json.Marshal(tomlString(e.text))
+		if err != nil {
+			return nil, false, err
+		}
+		values[i] = string(b)
+	}
+
+	order, err := o.sortElements(path, values)
+	if err != nil || order == nil {
+		return nil, false, err
+	}
+
+	changed := len(order) != len(elements)
+	sorted := make([]*tomlElement, len(order))
+	for i, idx := range order {
+		sorted[i] = elements[idx]
+		changed = changed || idx != i
+	}
+
+	return sorted, changed, nil
+}
+
+func tomlString(text string) string {
+	if len(text) < 2 {
+		return text
+	}
+
+	switch {
+	case text[0] == '\'' && text[len(text)-1] == '\'':
+		return text[1 : len(text)-1]
+	case text[0] == '"' && text[len(text)-1] == '"':
+		if s, err := strconv.Unquote(text); err == nil {
+			return s
+		}
+		return text[1 : len(text)-1]
+	}
+
+	return text
+}
+
+// lines returns the file's lines in their current order.
+func (f *iniFile) lines() []string {
+	var lines []string
+	for _, s := range append([]*iniSection{f.preamble}, f.sections...) {
+		lines = s.appendLines(lines)
+	}
+	return lines
+}
+
+func (s *iniSection) appendLines(lines []string) []string {
+	lines = append(lines, s.header...)
+	for _, g := range s.groups {
+		lines = appendBlank(lines, g.blank)
+		for _, e := range g.entries {
+			lines = append(lines, e.comments...)
+			lines = append(lines, e.lines...)
+		}
+		lines = append(lines, g.trailing...)
+	}
+	lines = appendBlank(lines, s.blank)
+
+	for _, c := range s.children {
+		lines = c.appendLines(lines)
+	}
+
+	return lines
+}
+
+func appendBlank(lines []string, n int) []string {
+	for i := 0; i < n; i++ {
+		lines = append(lines, "")
+	}
+	return lines
+}
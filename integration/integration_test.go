@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -58,13 +59,7 @@ func TestCheckUnique(t *testing.T) {
 	}
 	td := t.TempDir()
 
-	type test struct {
-		name        string
-		content     string
-		expectFail  bool
-		matchOutput *regexp.Regexp
-	}
-	tests := []test{
+	tests := []checkTest{
 		{
 			name: "unique and sorted",
 			content: `
@@ -126,6 +121,17 @@ f
 		},
 	}
 
+	runCheckTests(t, td, config, tests)
+}
+
+type checkTest struct {
+	name        string
+	content     string
+	expectFail  bool
+	matchOutput *regexp.Regexp
+}
+
+func runCheckTests(t *testing.T, td string, c config, tests []checkTest) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			d := detest.New(t)
@@ -134,7 +140,7 @@ f
 			err := ioutil.WriteFile(tf, []byte(test.content), 0755)
 			d.Require(d.Is(err, nil, "no error writing to %s", tf))
 
-			out, err := runOmegasort(d, config, tf)
+			out, err := runOmegasort(d, c, tf)
 			if test.expectFail {
 				d.IsNot(err, nil, "got an error when running omegasort")
 				d.Is(test.matchOutput.MatchString(out), true, "got expected output")
@@ -150,6 +156,370 @@ f
 	}
 }
 
+func TestCheckCSV(t *testing.T) {
+	config := config{
+		Format: "csv",
+		Keys:   []string{"ip,ip"},
+		Unique: true,
+		Check:  true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name: "sorted",
+			content: `name,ip
+b,1.1.1.1
+"a
+b",2.2.2.2
+`,
+			expectFail: false,
+		},
+		{
+			name: "not sorted",
+			content: `name,ip
+"a
+b",2.2.2.2
+b,1.1.1.1
+`,
+			expectFail:  true,
+			matchOutput: regexp.MustCompile("file is not sorted"),
+		},
+		{
+			name: "not unique",
+			content: `name,ip
+b,1.1.1.1
+"a
+b",2.2.2.2
+"a
+b",2.2.2.2
+`,
+			expectFail:  true,
+			matchOutput: regexp.MustCompile("file is not unique: line 5 is a repeat"),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckJSON(t *testing.T) {
+	config := config{
+		Sort:   "ip",
+		Format: "json",
+		Paths:  []string{".allowlist"},
+		Unique: true,
+		Check:  true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name: "sorted json",
+			content: `{
+  "allowlist": ["1.1.1.1", "10.0.0.2", "10.0.0.10"]
+}
+`,
+			expectFail: false,
+		},
+		{
+			name: "not sorted json",
+			content: `{
+  "allowlist": ["10.0.0.10", "10.0.0.2"]
+}
+`,
+			expectFail:  true,
+			matchOutput: regexp.MustCompile("file is not sorted"),
+		},
+		{
+			name: "not unique json",
+			content: `{
+  "allowlist": ["1.1.1.1", "10.0.0.2", "10.0.0.2"]
+}
+`,
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not unique: element 2 of \.allowlist is a repeat - "10\.0\.0\.2"`),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckCountLine(t *testing.T) {
+	config := config{
+		Sort:      "text",
+		CountLine: true,
+		Check:     true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "count matches",
+			content:    "2\na\nb\n",
+			expectFail: false,
+		},
+		{
+			name:        "count does not match",
+			content:     "3\na\nb\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile("the count on the first line is 3 but the file has 2 items"),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckGroups(t *testing.T) {
+	config := config{
+		Sort:          "text",
+		Groups:        true,
+		CommentPrefix: "#",
+		Check:         true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "groups are sorted",
+			content:    "# Fruits\napple\nbanana\n\nleek\nsquash\n",
+			expectFail: false,
+		},
+		{
+			name:        "group with heading is not sorted",
+			content:     "# Fruits\nbanana\napple\n\nleek\nsquash\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not sorted: the group "# Fruits" is not sorted`),
+		},
+		{
+			name:        "group without heading is not sorted",
+			content:     "# Fruits\napple\nbanana\n\nsquash\nleek\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not sorted: the group starting at line 5 is not sorted`),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckCollapse(t *testing.T) {
+	config := config{
+		Sort:     "network",
+		Collapse: true,
+		Check:    true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "networks are collapsed",
+			content:    "10.0.0.0/24\n10.0.2.0/24\n192.168.0.0/16\n",
+			expectFail: false,
+		},
+		{
+			name:        "networks can be merged",
+			content:     "10.0.0.0/25\n10.0.0.128/25\n192.168.0.0/16\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not collapsed: line 1 - 10.0.0.0/25 can be merged with or is covered by another network`),
+		},
+		{
+			name:        "network is covered by another",
+			content:     "10.0.0.0/8\n10.1.0.0/16\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not collapsed: line 2 - 10.1.0.0/16 can be merged`),
+		},
+		{
+			name:        "networks are not sorted",
+			content:     "192.168.0.0/16\n10.0.0.0/24\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not sorted`),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckSplitRanges(t *testing.T) {
+	config := config{
+		Sort:        "network",
+		SplitRanges: true,
+		Check:       true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "networks are all in CIDR form",
+			content:    "10.0.0.0/24\n10.0.2.0/24\n",
+			expectFail: false,
+		},
+		{
+			name:        "range is not split",
+			content:     "10.0.0.0/24\n10.0.2.0-10.0.2.2\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`line 2 - 10.0.2.0-10.0.2.2 should be written as 10.0.2.0/31, 10.0.2.2/32`),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckHostBits(t *testing.T) {
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "no host bits are set",
+			content:    "10.0.0.0/24\n10.1.0.0 255.255.0.0\n",
+			expectFail: false,
+		},
+		{
+			name:        "host bits are set",
+			content:     "10.0.0.0/24\n10.1.0.5/16\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file has host bits set: line 2 - 10.1.0.5/16 has host bits set, so it is the same as 10.1.0.0/16`),
+		},
+		{
+			name:        "host bits are set with a mask",
+			content:     "10.0.0.5 255.255.255.0\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`line 1 - 10.0.0.5 255.255.255.0 has host bits set`),
+		},
+	}
+	runCheckTests(t, td, config{Sort: "network", HostBits: "error", Check: true}, tests)
+
+	tests = []checkTest{
+		{
+			name:        "host bits must be cleared",
+			content:     "10.0.0.0/24\n10.1.0.5/16\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not canonical: line 2 - 10.1.0.5/16 should be written as 10.1.0.0/16`),
+		},
+	}
+	runCheckTests(t, td, config{Sort: "network", HostBits: "clear", Check: true}, tests)
+}
+
+func TestCheckOverlaps(t *testing.T) {
+	config := config{
+		Sort:          "network",
+		CheckOverlaps: true,
+		Check:         true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "no overlaps",
+			content:    "10.0.0.0/24\n10.0.1.0/24\n",
+			expectFail: false,
+		},
+		{
+			name:       "overlaps",
+			content:    "10.0.0.0/8\n10.1.0.0/16\n10.1.0.0/16\n",
+			expectFail: true,
+			matchOutput: regexp.MustCompile(
+				`(?s)file has overlapping networks:\n` +
+					`line 1 - 10.0.0.0/8 contains line 2 - 10.1.0.0/16\n` +
+					`line 1 - 10.0.0.0/8 contains line 3 - 10.1.0.0/16\n` +
+					`line 2 - 10.1.0.0/16 is the same network as line 3 - 10.1.0.0/16\n`,
+			),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+
+	config.SplitRanges = true
+	tests = []checkTest{
+		{
+			name:        "overlaps with split ranges",
+			content:     "10.0.0.0-10.0.0.2\n10.0.0.0/8\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`(?s)file has overlapping networks:\nline 2 - 10.0.0.0/8 contains line 1 - 10.0.0.0-10.0.0.2\n$`),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestCheckCanonical(t *testing.T) {
+	config := config{
+		Sort:  "ip-or-network",
+		Check: true,
+	}
+	td := t.TempDir()
+
+	tests := []checkTest{
+		{
+			name:       "canonical",
+			content:    "10.0.0.0/24\n10.0.0.1\n2001:db8::1\n",
+			expectFail: false,
+		},
+		{
+			name:        "not canonical",
+			content:     "10.0.0.0/24\n10.0.0.1\n2001:DB8:0::1\n",
+			expectFail:  true,
+			matchOutput: regexp.MustCompile(`file is not canonical: line 3 - 2001:DB8:0::1 should be written as 2001:db8::1`),
+		},
+	}
+
+	runCheckTests(t, td, config, tests)
+}
+
+func TestSeparators(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  config
+		content string
+		expect  string
+	}{
+		{
+			name:    "null data",
+			config:  config{Sort: "path", NullData: true},
+			content: "b/c\x00a\nb\x00a/b\x00",
+			expect:  "a\nb\x00a/b\x00b/c\x00",
+		},
+		{
+			name:    "record separator",
+			config:  config{Sort: "ip", RecordSeparator: `\x1e`},
+			content: "10.0.0.10\x1e10.0.0.2\x1e",
+			expect:  "10.0.0.2\x1e10.0.0.10\x1e",
+		},
+		{
+			name:    "csv with CR line endings",
+			config:  config{Format: "csv", Keys: []string{"ip,ip"}},
+			content: "name,ip\r\"b\rc\",2.2.2.2\ra,1.1.1.1\r",
+			expect:  "name,ip\ra,1.1.1.1\r\"b\rc\",2.2.2.2\r",
+		},
+		{
+			name:    "paragraphs with leading and trailing blank lines",
+			config:  config{Sort: "text", Records: "paragraphs"},
+			content: "\n\nb\n  two\n\na\n  one\n\n\n",
+			expect:  "\n\na\n  one\n\nb\n  two\n\n\n",
+		},
+		{
+			name:    "sorted paragraphs with extra blank lines",
+			config:  config{Sort: "text", Records: "paragraphs"},
+			content: "a\n  one\n\n\n\nb\n  two\n",
+			expect:  "a\n  one\n\nb\n  two\n",
+		},
+	}
+
+	td := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := detest.New(t)
+
+			tf := filepath.Join(td, strings.ReplaceAll(test.name, " ", "-"))
+			err := ioutil.WriteFile(tf, []byte(test.content), 0755)
+			d.Require(d.Is(err, nil, "no error writing to %s", tf))
+
+			out, err := runOmegasort(d, test.config, tf)
+			d.Is(out, "", "no output when running omegasort")
+			d.Require(d.Is(err, nil, "no error running omegasort"))
+			d.Is(readFile(d, tf), test.expect, "got the expected sorted output")
+		})
+	}
+}
+
 func TestFileIsNotModifiedWhenAlreadySorted(t *testing.T) {
 	d := detest.New(t)
 
@@ -184,12 +554,45 @@ f
 }
 
 type config struct {
-	Sort            string `json:"sort"`
-	Locale          string `json:"locale"`
-	Unique          bool   `json:"unique"`
-	CaseInsensitive bool   `json:"case_insensitive"`
-	Reverse         bool   `json:"reverse"`
-	Windows         bool   `json:"windows"`
+	Sort            string   `json:"sort"`
+	Format          string   `json:"format"`
+	Locale          string   `json:"locale"`
+	Unique          bool     `json:"unique"`
+	CaseInsensitive bool     `json:"case_insensitive"`
+	Reverse         bool     `json:"reverse"`
+	Windows         bool     `json:"windows"`
+	NormalizeURLs   bool     `json:"normalize_urls"`
+	IPFamilies      string   `json:"ip_families"`
+	MappedAsV4      bool     `json:"mapped_as_v4"`
+	UUIDTimeOrder   bool     `json:"uuid_time_order"`
+	DatetimeFormats []string `json:"datetime_formats"`
+	Timezone        string   `json:"timezone"`
+	DateOrder       string   `json:"date_order"`
+	Collapse        bool     `json:"collapse"`
+	SplitRanges     bool     `json:"split_ranges"`
+	CheckOverlaps   bool     `json:"check_overlaps"`
+	HostBits        string   `json:"host_bits"`
+	Display         string   `json:"display"`
+	Canonicalize    bool     `json:"canonicalize"`
+	Keys            []string `json:"keys"`
+	KeyRegex        string   `json:"key_regex"`
+	Unmatched       string   `json:"key_regex_unmatched"`
+	JSONMissing     string   `json:"json_missing"`
+	UniqueByKey     bool     `json:"unique_by_key"`
+	Paths           []string `json:"paths"`
+	SortKeys        bool     `json:"sort_keys"`
+	SortSections    bool     `json:"sort_sections"`
+	Records         string   `json:"records"`
+	RecordStart     string   `json:"record_start"`
+	NullData        bool     `json:"null_data"`
+	RecordSeparator string   `json:"record_separator"`
+	CommentPrefix   string   `json:"comment_prefix"`
+	AttachBlank     bool     `json:"attach_blank_lines"`
+	HeaderLines     int      `json:"header_lines"`
+	FooterLines     int      `json:"footer_lines"`
+	KeepLeading     string   `json:"keep_leading"`
+	CountLine       bool     `json:"count_line"`
+	Groups          bool     `json:"groups"`
 	Check           bool
 }
 
@@ -229,6 +632,9 @@ func runOneTest(t *testing.T, td, path string) {
 		input = test[0]
 		expect = test[1]
 	}
+	// The input starts with the newline that follows the "----" separator,
+	// which would otherwise be sorted as an empty line.
+	input = strings.TrimPrefix(input, "\n")
 	expect = strings.TrimSpace(expect)
 
 	tf := filepath.Join(td, filepath.Base(path))
@@ -253,7 +659,13 @@ func readFile(d *detest.D, path string) string {
 }
 
 func (c *config) args() []string {
-	args := []string{"--sort", c.Sort}
+	args := []string{}
+	if c.Sort != "" {
+		args = append(args, "--sort", c.Sort)
+	}
+	if c.Format != "" {
+		args = append(args, "--format", c.Format)
+	}
 	if c.Locale != "" {
 		args = append(args, "--locale", c.Locale)
 	}
@@ -269,6 +681,102 @@ func (c *config) args() []string {
 	if c.Windows {
 		args = append(args, "--windows")
 	}
+	if c.NormalizeURLs {
+		args = append(args, "--normalize-urls")
+	}
+	if c.IPFamilies != "" {
+		args = append(args, "--ip-families", c.IPFamilies)
+	}
+	if c.MappedAsV4 {
+		args = append(args, "--mapped-as-v4")
+	}
+	if c.UUIDTimeOrder {
+		args = append(args, "--uuid-time-order")
+	}
+	for _, f := range c.DatetimeFormats {
+		args = append(args, "--datetime-format", f)
+	}
+	if c.Timezone != "" {
+		args = append(args, "--timezone", c.Timezone)
+	}
+	if c.DateOrder != "" {
+		args = append(args, "--date-order", c.DateOrder)
+	}
+	if c.Collapse {
+		args = append(args, "--collapse")
+	}
+	if c.SplitRanges {
+		args = append(args, "--split-ranges")
+	}
+	if c.CheckOverlaps {
+		args = append(args, "--check-overlaps")
+	}
+	if c.HostBits != "" {
+		args = append(args, "--host-bits", c.HostBits)
+	}
+	if c.Display != "" {
+		args = append(args, "--display", c.Display)
+	}
+	if c.Canonicalize {
+		args = append(args, "--canonicalize")
+	}
+	for _, k := range c.Keys {
+		args = append(args, "--key", k)
+	}
+	if c.KeyRegex != "" {
+		args = append(args, "--key-regex", c.KeyRegex)
+	}
+	if c.Unmatched != "" {
+		args = append(args, "--key-regex-unmatched", c.Unmatched)
+	}
+	if c.JSONMissing != "" {
+		args = append(args, "--json-missing", c.JSONMissing)
+	}
+	if c.UniqueByKey {
+		args = append(args, "--unique-by-key")
+	}
+	for _, p := range c.Paths {
+		args = append(args, "--path", p)
+	}
+	if c.SortKeys {
+		args = append(args, "--sort-keys")
+	}
+	if c.SortSections {
+		args = append(args, "--sort-sections")
+	}
+	if c.Records != "" {
+		args = append(args, "--records", c.Records)
+	}
+	if c.RecordStart != "" {
+		args = append(args, "--record-start", c.RecordStart)
+	}
+	if c.NullData {
+		args = append(args, "--null-data")
+	}
+	if c.RecordSeparator != "" {
+		args = append(args, "--record-separator", c.RecordSeparator)
+	}
+	if c.CommentPrefix != "" {
+		args = append(args, "--comment-prefix", c.CommentPrefix)
+	}
+	if c.AttachBlank {
+		args = append(args, "--attach-blank-lines")
+	}
+	if c.HeaderLines != 0 {
+		args = append(args, "--header-lines", strconv.Itoa(c.HeaderLines))
+	}
+	if c.FooterLines != 0 {
+		args = append(args, "--footer-lines", strconv.Itoa(c.FooterLines))
+	}
+	if c.KeepLeading != "" {
+		args = append(args, "--keep-leading", c.KeepLeading)
+	}
+	if c.CountLine {
+		args = append(args, "--count-line")
+	}
+	if c.Groups {
+		args = append(args, "--groups")
+	}
 	if c.Check {
 		args = append(args, "--check")
 	} else {
@@ -0,0 +1,115 @@
+// Package hostname parses domain names into labels which can be compared
+// from the top-level domain inward. Names are normalized so that names which
+// refer to the same domain have the same labels. Labels are lowercased, and
+// punycode ("xn--") labels are decoded to Unicode and put in NFC form.
+package hostname
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Wildcard is the label for a leading "*" in a name like "*.example.com".
+const Wildcard = "*"
+
+var lower = cases.Lower(language.Und)
+
+// Parse returns the normalized labels of a hostname, starting with the
+// top-level domain. A trailing "." is ignored, so "example.com." and
+// "example.com" have the same labels. The leftmost label may be a "*"
+// wildcard.
+func Parse(name string) ([]string, error) {
+	trimmed := strings.TrimSuffix(name, ".")
+	if trimmed == "" {
+		return nil, errors.New("the name is empty")
+	}
+
+	parts := strings.Split(trimmed, ".")
+	labels := make([]string, len(parts))
+	for i, p := range parts {
+		label, err := normalizeLabel(p, i == 0)
+		if err != nil {
+			return nil, err
+		}
+		labels[len(parts)-1-i] = label
+	}
+
+	return labels, nil
+}
+
+// Compare compares two sets of labels returned by Parse. Labels are compared
+// one at a time, so all the names in a domain sort together. A parent domain
+// sorts before the names under it, and a wildcard sorts before any other
+// label at the same level.
+func Compare(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		switch {
+		case a[i] == Wildcard:
+			return -1
+		case b[i] == Wildcard:
+			return 1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+func normalizeLabel(label string, isFirst bool) (string, error) {
+	if label == "" {
+		return "", errors.New("the name contains an empty label")
+	}
+	if label == Wildcard {
+		if !isFirst {
+			return "", errors.New("a * wildcard can only be the leftmost label")
+		}
+		return label, nil
+	}
+
+	if len(label) > 4 && strings.EqualFold(label[:4], "xn--") {
+		decoded, err := idna.Lookup.ToUnicode(label)
+		if err != nil {
+			return "", fmt.Errorf("the label %q is not valid punycode: %w", label, err)
+		}
+		label = decoded
+	}
+
+	label = norm.NFC.String(lower.String(label))
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+		return "", fmt.Errorf("the label %q starts or ends with a hyphen", label)
+	}
+	for _, r := range label {
+		if !isLabelRune(r) {
+			return "", fmt.Errorf("the label %q contains the character %q", label, r)
+		}
+	}
+
+	return label, nil
+}
+
+// isLabelRune allows underscores in addition to the characters allowed by
+// the hostname RFCs, since they're common in names like "_dmarc.example.com".
+// It also allows non-ASCII symbols, since some registries allow emoji
+// domains like "xn--e28h.ws".
+func isLabelRune(r rune) bool {
+	if r < unicode.MaxASCII {
+		return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_'
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || unicode.IsSymbol(r)
+}
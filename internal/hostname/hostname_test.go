@@ -0,0 +1,85 @@
+package hostname
+
+import (
+	"testing"
+
+	"github.com/houseabsolute/detest/pkg/detest"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect []string
+	}{
+		{"example.com", []string{"com", "example"}},
+		{"WWW.Example.COM.", []string{"com", "example", "www"}},
+		{"*.example.com", []string{"com", "example", "*"}},
+		{"_dmarc.example.com", []string{"com", "example", "_dmarc"}},
+		{"localhost", []string{"localhost"}},
+		{"xn--bcher-kva.de", []string{"de", "bücher"}},
+		{"XN--BCHER-KVA.de", []string{"de", "bücher"}},
+		{"Bücher.de", []string{"de", "bücher"}},
+		{"xn--mnchen-3ya.de", []string{"de", "münchen"}},
+		{"xn--wgv71a119e.jp", []string{"jp", "日本語"}},
+		{"xn--e28h.com", []string{"com", "😀"}},
+		{"xn--abcdefghij-t366i.com", []string{"com", "abcdefghij😀"}},
+		{"xn--ab-oo82as2w.com", []string{"com", "a𠀀b😀"}},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		labels, err := Parse(test.name)
+		d.Is(err, nil, "no error parsing %q", test.name)
+		d.Is(labels, test.expect, "labels for %q", test.name)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect string
+	}{
+		{"", "the name is empty"},
+		{".", "the name is empty"},
+		{"a..example.com", "the name contains an empty label"},
+		{"foo.*.example.com", "a * wildcard can only be the leftmost label"},
+		{"-foo.example.com", `the label "-foo" starts or ends with a hyphen`},
+		{"foo bar.example.com", `the label "foo bar" contains the character ' '`},
+		{"xn--a-!.com", `the label "xn--a-!" is not valid punycode: idna: disallowed rune U+0021`},
+		{"xn--a-999999999999.com", `the label "xn--a-999999999999" is not valid punycode: idna: invalid label "a-999999999999"`},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		_, err := Parse(test.name)
+		if d.Is(err != nil, true, "got an error parsing %q", test.name) {
+			d.Is(err.Error(), test.expect, "error for %q", test.name)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"example.com", "example.com", 0},
+		{"Example.COM", "example.com.", 0},
+		{"xn--bcher-kva.de", "bücher.de", 0},
+		{"a.example.com", "b.example.com", -1},
+		{"a.example.org", "b.example.com", 1},
+		{"example.com", "a.example.com", -1},
+		{"*.example.com", "a.example.com", -1},
+		{"example.com", "*.example.com", -1},
+		{"z.a.com", "b.com", -1},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		a, err := Parse(test.a)
+		d.Is(err, nil, "no error parsing %q", test.a)
+		b, err := Parse(test.b)
+		d.Is(err, nil, "no error parsing %q", test.b)
+		d.Is(Compare(a, b), test.expect, "Compare(%q, %q)", test.a, test.b)
+	}
+}
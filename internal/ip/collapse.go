@@ -0,0 +1,132 @@
+package ip
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// Contains returns true if every address in inner is also in outer.
+func Contains(outer, inner CIDR) bool {
+	if outer.Version() != inner.Version() || outer.Prefix() > inner.Prefix() {
+		return false
+	}
+	return supernet(inner, outer.Prefix()) == outer
+}
+
+// Compare orders networks by version, then address, then prefix length, so
+// that a network comes right before the smaller networks it contains.
+func Compare(a, b CIDR) int {
+	if a.Version() != b.Version() {
+		if a.Version() < b.Version() {
+			return -1
+		}
+		return 1
+	}
+
+	if c := bytes.Compare(a.Addr().AsNetIP(), b.Addr().AsNetIP()); c != 0 {
+		return c
+	}
+
+	switch {
+	case a.Prefix() < b.Prefix():
+		return -1
+	case a.Prefix() > b.Prefix():
+		return 1
+	}
+	return 0
+}
+
+// Collapse returns the smallest sorted list of networks which covers exactly
+// the same addresses as the given networks. Networks which are contained in
+// another network are removed, and pairs of adjacent networks which make up
+// a larger network are merged into it.
+func Collapse(cidrs []CIDR) []CIDR {
+	sorted := make([]CIDR, len(cidrs))
+	copy(sorted, cidrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return Compare(sorted[i], sorted[j]) < 0
+	})
+
+	var collapsed []CIDR
+	for _, c := range sorted {
+		// Since the networks are sorted, a network can only be contained in
+		// the last network we kept.
+		if len(collapsed) > 0 && Contains(collapsed[len(collapsed)-1], c) {
+			continue
+		}
+
+		// Merging two networks may make a network that can be merged with
+		// the one before it, so we keep going until nothing changes.
+		for len(collapsed) > 0 {
+			last := collapsed[len(collapsed)-1]
+			parent, ok := merge(last, c)
+			if !ok {
+				break
+			}
+			collapsed = collapsed[:len(collapsed)-1]
+			c = parent
+		}
+		collapsed = append(collapsed, c)
+	}
+
+	return collapsed
+}
+
+// merge returns the network made up of a and b if they are the two halves of
+// the same larger network.
+func merge(a, b CIDR) (CIDR, bool) {
+	if a.Version() != b.Version() || a.Prefix() != b.Prefix() || a.Prefix() == 0 || a == b {
+		return nil, false
+	}
+
+	parent := supernet(a, a.Prefix()-1)
+	if supernet(b, b.Prefix()-1) != parent {
+		return nil, false
+	}
+	return parent, true
+}
+
+// supernet returns the network with the given prefix length which contains
+// c. The prefix must not be longer than c's prefix.
+func supernet(c CIDR, prefix uint8) CIDR {
+	bits := 32
+	if c.Version() == 6 {
+		bits = 128
+	}
+
+	return CIDRFromIPNet(&net.IPNet{
+		IP:   c.Addr().AsNetIP(),
+		Mask: net.CIDRMask(int(prefix), bits),
+	})
+}
+
+// Overlaps returns the indexes of every pair of networks where the first
+// network contains the second. Two networks either don't overlap at all or
+// one contains the other, so these are all of the overlapping pairs. A
+// network which appears twice contains its second appearance.
+func Overlaps(cidrs []CIDR) [][2]int {
+	order := make([]int, len(cidrs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return Compare(cidrs[order[i]], cidrs[order[j]]) < 0
+	})
+
+	// In sorted order, the networks which contain a network are the ones
+	// still open when we reach it, so we keep those on a stack.
+	var pairs [][2]int
+	var open []int
+	for _, idx := range order {
+		for len(open) > 0 && !Contains(cidrs[open[len(open)-1]], cidrs[idx]) {
+			open = open[:len(open)-1]
+		}
+		for _, o := range open {
+			pairs = append(pairs, [2]int{o, idx})
+		}
+		open = append(open, idx)
+	}
+
+	return pairs
+}
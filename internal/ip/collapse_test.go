@@ -0,0 +1,97 @@
+package ip
+
+import (
+	"testing"
+
+	"github.com/houseabsolute/detest/pkg/detest"
+)
+
+func TestCollapse(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []string
+		expect []string
+	}{
+		{
+			"adjacent networks are merged",
+			[]string{"10.0.0.128/25", "10.0.0.0/25"},
+			[]string{"10.0.0.0/24"},
+		},
+		{
+			"merges cascade",
+			[]string{"10.0.0.0/25", "10.0.1.0/24", "10.0.0.128/25"},
+			[]string{"10.0.0.0/23"},
+		},
+		{
+			"contained networks are removed",
+			[]string{"10.1.2.0/24", "10.0.0.0/8", "10.0.0.1/32", "192.168.0.0/16"},
+			[]string{"10.0.0.0/8", "192.168.0.0/16"},
+		},
+		{
+			"adjacent networks which are not halves of one network are kept",
+			[]string{"10.0.1.0/24", "10.0.2.0/24"},
+			[]string{"10.0.1.0/24", "10.0.2.0/24"},
+		},
+		{
+			"duplicates are removed",
+			[]string{"10.0.0.0/24", "10.0.0.0/24"},
+			[]string{"10.0.0.0/24"},
+		},
+		{
+			"IPv6",
+			[]string{"2001:db8::/33", "2001:db8:8000::/33", "2001:db8::1/128", "::1/128"},
+			[]string{"::1/128", "2001:db8::/32"},
+		},
+		{
+			"IPv4 before IPv6",
+			[]string{"2001:db8::/32", "10.0.0.0/8"},
+			[]string{"10.0.0.0/8", "2001:db8::/32"},
+		},
+		{
+			"everything",
+			[]string{"0.0.0.0/1", "128.0.0.0/1", "1.2.3.4/32"},
+			[]string{"0.0.0.0/0"},
+		},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		cidrs := make([]CIDR, len(test.input))
+		for i, s := range test.input {
+			cidrs[i] = MustParseCIDROrIP(s)
+		}
+
+		var got []string
+		for _, c := range Collapse(cidrs) {
+			got = append(got, c.String())
+		}
+		d.Is(got, test.expect, test.name)
+	}
+}
+
+func TestContains(t *testing.T) {
+	d := detest.New(t)
+	d.Is(Contains(MustParseCIDROrIP("10.0.0.0/8"), MustParseCIDROrIP("10.1.0.0/16")), true, "/8 contains /16")
+	d.Is(Contains(MustParseCIDROrIP("10.1.0.0/16"), MustParseCIDROrIP("10.0.0.0/8")), false, "/16 does not contain /8")
+	d.Is(Contains(MustParseCIDROrIP("10.0.0.0/8"), MustParseCIDROrIP("11.0.0.0/16")), false, "different networks")
+	d.Is(Contains(MustParseCIDROrIP("::/0"), MustParseCIDROrIP("10.0.0.0/8")), false, "different versions")
+}
+
+func TestOverlaps(t *testing.T) {
+	cidrs := []CIDR{
+		MustParseCIDROrIP("10.1.0.0/16"),
+		MustParseCIDROrIP("192.168.0.0/24"),
+		MustParseCIDROrIP("10.0.0.0/8"),
+		MustParseCIDROrIP("10.1.2.3/32"),
+		MustParseCIDROrIP("11.0.0.0/8"),
+		MustParseCIDROrIP("192.168.0.0/24"),
+	}
+
+	d := detest.New(t)
+	d.Is(
+		Overlaps(cidrs),
+		[][2]int{{2, 0}, {2, 3}, {0, 3}, {1, 5}},
+		"got every overlapping pair",
+	)
+	d.Is(Overlaps(cidrs[1:3]), [][2]int(nil), "no overlaps")
+}
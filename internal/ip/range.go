@@ -0,0 +1,181 @@
+package ip
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// Range is a range of addresses from Start to End, inclusive. Every CIDR is
+// a range, but a range may not be a single CIDR.
+type Range struct {
+	start Addr
+	end   Addr
+}
+
+// RangeFromCIDR returns the range of addresses in a CIDR.
+func RangeFromCIDR(c CIDR) Range {
+	ipNet := c.ToIPNet()
+	end := make(net.IP, len(ipNet.IP))
+	for i := range ipNet.IP {
+		end[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+	}
+
+	return Range{start: c.Addr(), end: FromNetIP(end)}
+}
+
+// ParseRange parses a CIDR like "10.0.0.0/24", a range like
+// "10.0.0.0-10.0.0.255", or an IPv4 address followed by a dotted netmask or
+// wildcard mask, like "10.0.0.0 255.255.255.0" or "10.0.0.0 0.0.0.255". A
+// mask is treated as a netmask if it can be one, so "0.0.0.0" and
+// "255.255.255.255" are netmasks rather than wildcard masks. Host bits are
+// cleared in CIDRs and masked addresses.
+func ParseRange(s string) (Range, error) {
+	if strings.Contains(s, "/") {
+		c, err := CIDRFromString(s)
+		if err != nil {
+			return Range{}, err
+		}
+		return RangeFromCIDR(c), nil
+	}
+
+	if strings.Contains(s, "-") {
+		parts := strings.SplitN(s, "-", 2)
+		start := FromString(strings.TrimSpace(parts[0]))
+		end := FromString(strings.TrimSpace(parts[1]))
+		if start == nil || end == nil {
+			return Range{}, fmt.Errorf("invalid IP address range: %s", s)
+		}
+		if start.Version() != end.Version() {
+			return Range{}, fmt.Errorf("the start and end of the range %s are different IP versions", s)
+		}
+		if bytes.Compare(start.AsNetIP(), end.AsNetIP()) > 0 {
+			return Range{}, fmt.Errorf("the start of the range %s is after the end", s)
+		}
+		return Range{start: start, end: end}, nil
+	}
+
+	if fields := strings.Fields(s); len(fields) == 2 {
+		addr := net.ParseIP(fields[0]).To4()
+		mask := net.ParseIP(fields[1]).To4()
+		if addr == nil || mask == nil {
+			return Range{}, fmt.Errorf("invalid IPv4 address and mask: %s", s)
+		}
+		prefix, ok := maskPrefix(mask)
+		if !ok {
+			return Range{}, fmt.Errorf("%s is not a valid netmask or wildcard mask", fields[1])
+		}
+		return RangeFromCIDR(CIDRFromIPNet(&net.IPNet{IP: addr, Mask: net.CIDRMask(prefix, 32)})), nil
+	}
+
+	c, err := CIDRFromString(s)
+	if err != nil {
+		return Range{}, err
+	}
+	return RangeFromCIDR(c), nil
+}
+
+// maskPrefix returns the prefix length for a netmask, like 255.255.255.0,
+// or a wildcard mask, which is the inverse of a netmask, like 0.0.0.255.
+func maskPrefix(mask net.IP) (int, bool) {
+	if ones, bits := net.IPMask(mask).Size(); bits != 0 {
+		return ones, true
+	}
+
+	inverse := make(net.IPMask, len(mask))
+	for i := range mask {
+		inverse[i] = ^mask[i]
+	}
+	if ones, bits := inverse.Size(); bits != 0 {
+		return ones, true
+	}
+
+	return 0, false
+}
+
+// Version returns the IP version of the range; 4 or 6.
+func (r Range) Version() uint8 {
+	return r.start.Version()
+}
+
+// Start returns the first address in the range.
+func (r Range) Start() Addr {
+	return r.start
+}
+
+// End returns the last address in the range.
+func (r Range) End() Addr {
+	return r.end
+}
+
+// String returns the range as "start-end".
+func (r Range) String() string {
+	return fmt.Sprintf("%s-%s", r.start, r.end)
+}
+
+// CIDR returns the range as a CIDR if it is exactly one network.
+func (r Range) CIDR() (CIDR, bool) {
+	cidrs := r.CIDRs()
+	if len(cidrs) != 1 {
+		return nil, false
+	}
+	return cidrs[0], true
+}
+
+// CIDRs returns the smallest sorted list of networks which covers exactly
+// the addresses in the range.
+func (r Range) CIDRs() []CIDR {
+	bits := 32
+	if r.Version() == 6 {
+		bits = 128
+	}
+
+	start := new(big.Int).SetBytes(r.start.AsNetIP())
+	end := new(big.Int).SetBytes(r.end.AsNetIP())
+	one := big.NewInt(1)
+
+	var cidrs []CIDR
+	for start.Cmp(end) <= 0 {
+		// The largest block that starts at start is limited by the number
+		// of trailing zero bits in start. We then shrink it until it
+		// doesn't go past the end.
+		size := int(start.TrailingZeroBits())
+		if start.Sign() == 0 || size > bits {
+			size = bits
+		}
+		for size > 0 {
+			last := new(big.Int).Lsh(one, uint(size))
+			last.Add(last, start).Sub(last, one)
+			if last.Cmp(end) <= 0 {
+				break
+			}
+			size--
+		}
+
+		ip := make(net.IP, bits/8)
+		start.FillBytes(ip)
+		cidrs = append(cidrs, CIDRFromIPNet(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits-size, bits)}))
+
+		start.Add(start, new(big.Int).Lsh(one, uint(size)))
+	}
+
+	return cidrs
+}
+
+// CompareRanges orders ranges by version, then start address, then size,
+// with larger ranges first. This is the same order as Compare for CIDRs.
+func CompareRanges(a, b Range) int {
+	if a.Version() != b.Version() {
+		if a.Version() < b.Version() {
+			return -1
+		}
+		return 1
+	}
+
+	if c := bytes.Compare(a.start.AsNetIP(), b.start.AsNetIP()); c != 0 {
+		return c
+	}
+	return -bytes.Compare(a.end.AsNetIP(), b.end.AsNetIP())
+}
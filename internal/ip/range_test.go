@@ -0,0 +1,83 @@
+package ip
+
+import (
+	"testing"
+
+	"github.com/houseabsolute/detest/pkg/detest"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input string
+		start string
+		end   string
+	}{
+		{"10.0.0.0/24", "10.0.0.0", "10.0.0.255"},
+		{"10.0.0.5/24", "10.0.0.0", "10.0.0.255"},
+		{"10.0.0.0-10.0.0.255", "10.0.0.0", "10.0.0.255"},
+		{"10.0.0.3 - 10.0.0.9", "10.0.0.3", "10.0.0.9"},
+		{"10.0.0.0 255.255.255.0", "10.0.0.0", "10.0.0.255"},
+		{"10.0.0.0 0.0.0.255", "10.0.0.0", "10.0.0.255"},
+		{"10.0.0.7 255.255.255.255", "10.0.0.7", "10.0.0.7"},
+		{"0.0.0.0 0.0.0.0", "0.0.0.0", "255.255.255.255"},
+		{"2001:db8::-2001:db8::ff", "2001:db8::", "2001:db8::ff"},
+		{"2001:db8::/120", "2001:db8::", "2001:db8::ff"},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		r, err := ParseRange(test.input)
+		if d.Is(err, nil, "no error parsing %q", test.input) {
+			d.Is(r.Start().String(), test.start, "start of %q", test.input)
+			d.Is(r.End().String(), test.end, "end of %q", test.input)
+		}
+	}
+}
+
+func TestParseRangeErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"10.0.0.9-10.0.0.1", "the start of the range 10.0.0.9-10.0.0.1 is after the end"},
+		{"10.0.0.1-::1", "the start and end of the range 10.0.0.1-::1 are different IP versions"},
+		{"10.0.0.1-foo", "invalid IP address range: 10.0.0.1-foo"},
+		{"10.0.0.0 255.0.255.0", "255.0.255.0 is not a valid netmask or wildcard mask"},
+		{"::1 255.255.255.0", "invalid IPv4 address and mask: ::1 255.255.255.0"},
+		{"not a network", "invalid CIDR address: not a network"},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		_, err := ParseRange(test.input)
+		if d.Is(err != nil, true, "got an error parsing %q", test.input) {
+			d.Is(err.Error(), test.expect, "error for %q", test.input)
+		}
+	}
+}
+
+func TestRangeCIDRs(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect []string
+	}{
+		{"10.0.0.0/24", []string{"10.0.0.0/24"}},
+		{"10.0.0.0-10.0.1.255", []string{"10.0.0.0/23"}},
+		{"10.0.0.1-10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254-255.255.255.255", []string{"255.255.255.254/31"}},
+		{"2001:db8::1-2001:db8::3", []string{"2001:db8::1/128", "2001:db8::2/127"}},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		r, err := ParseRange(test.input)
+		d.Require(d.Is(err, nil, "no error parsing %q", test.input))
+
+		var got []string
+		for _, c := range r.CIDRs() {
+			got = append(got, c.String())
+		}
+		d.Is(got, test.expect, "CIDRs for %q", test.input)
+	}
+}
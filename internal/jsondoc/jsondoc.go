@@ -0,0 +1,329 @@
+// Package jsondoc decodes JSON documents into values which keep the order of
+// object keys, and encodes them again using the indentation of the original
+// document.
+//
+// Arrays are decoded as *Array, numbers as json.Number, and objects as
+// *Object. Everything else is decoded the same way as by the encoding/json
+// package. Arrays and objects remember whether they were on a single line,
+// so they can be written back the same way.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// layout records how an array or object was written in the original
+// document.
+type layout struct {
+	// inline is true if the whole value was on a single line.
+	inline bool
+	// spaced is true if the value had a space after each "," and ":", like
+	// `[1, 2]` rather than `[1,2]`. This only matters for inline values.
+	spaced bool
+}
+
+// Array is a JSON array.
+type Array struct {
+	layout
+	elements []interface{}
+}
+
+// Elements returns the array's elements.
+func (a *Array) Elements() []interface{} {
+	return a.elements
+}
+
+// SetElements replaces the array's elements.
+func (a *Array) SetElements(elements []interface{}) {
+	a.elements = elements
+}
+
+// Object is a JSON object which keeps its keys in order.
+type Object struct {
+	layout
+	keys   []string
+	values map[string]interface{}
+}
+
+// Keys returns the object's keys in order.
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+// SetKeys changes the order of the object's keys. The new keys must be a
+// reordering of the existing keys.
+func (o *Object) SetKeys(keys []string) {
+	o.keys = keys
+}
+
+// Get returns the value for the given key.
+func (o *Object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets the value for the given key. If the key is new it is added at the
+// end of the object.
+func (o *Object) Set(key string, v interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+// Document is a decoded JSON document along with the formatting details we
+// need to write it back out.
+type Document struct {
+	Value interface{}
+	// Indent is the string used for each level of indentation. If this is
+	// empty the document is written on a single line.
+	Indent          string
+	TrailingNewline bool
+}
+
+// Decode decodes a JSON document.
+func Decode(content []byte) (*Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	d := decoder{dec, content}
+	v, err := d.decodeValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("the document contains more than one JSON value")
+	}
+
+	return &Document{
+		Value:           v,
+		Indent:          detectIndent(content),
+		TrailingNewline: bytes.HasSuffix(content, []byte("\n")),
+	}, nil
+}
+
+type decoder struct {
+	dec     *json.Decoder
+	content []byte
+}
+
+func (d decoder) decodeValue() (interface{}, error) {
+	dec := d.dec
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	// The offset is just past the opening delimiter.
+	start := dec.InputOffset() - 1
+
+	switch delim {
+	case '[':
+		arr := &Array{elements: []interface{}{}}
+		for dec.More() {
+			v, err := d.decodeValue()
+			if err != nil {
+				return nil, err
+			}
+			arr.elements = append(arr.elements, v)
+		}
+		// This consumes the closing ']'.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		arr.layout = d.layout(start)
+		return arr, nil
+	case '{':
+		obj := &Object{values: map[string]interface{}{}}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected an object key but got %v", keyTok)
+			}
+			// We can only keep one value per key, so rather than silently
+			// dropping the others when we write the document back out, we
+			// treat this as an error.
+			if _, exists := obj.values[key]; exists {
+				return nil, fmt.Errorf("the key %q appears more than once in the same object", key)
+			}
+			v, err := d.decodeValue()
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key, v)
+		}
+		// This consumes the closing '}'.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		obj.layout = d.layout(start)
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("unexpected delimiter %s", delim)
+}
+
+// layout returns the layout of the array or object which starts at the
+// given offset and ends at the decoder's current offset.
+func (d decoder) layout(start int64) layout {
+	raw := d.content[start:d.dec.InputOffset()]
+	if bytes.ContainsRune(raw, '\n') {
+		return layout{}
+	}
+
+	// We look at the first "," or ":" that isn't in a string.
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '"':
+			for i++; i < len(raw) && raw[i] != '"'; i++ {
+				if raw[i] == '\\' {
+					i++
+				}
+			}
+		case ',', ':':
+			return layout{inline: true, spaced: i+1 < len(raw) && raw[i+1] == ' '}
+		}
+	}
+
+	return layout{inline: true}
+}
+
+// detectIndent returns the leading whitespace of the first indented line in
+// the document. If there is no indented line it returns an empty string.
+func detectIndent(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n")[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(trimmed) == len(line) {
+			continue
+		}
+		return line[:len(line)-len(trimmed)]
+	}
+
+	return ""
+}
+
+// Encode writes the document using its original indentation.
+func (d *Document) Encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := d.encodeValue(buf, d.Value, 0); err != nil {
+		return nil, err
+	}
+	if d.TrailingNewline {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeValue encodes a single value on one line.
+func EncodeValue(v interface{}) (string, error) {
+	d := &Document{}
+	buf := &bytes.Buffer{}
+	if err := d.encodeValue(buf, v, 0); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// encodeValue writes a value. An array or object is written with one value
+// per line, unless it was on a single line in the original document or the
+// document has no indentation.
+func (d *Document) encodeValue(buf *bytes.Buffer, v interface{}, depth int) error {
+	switch t := v.(type) {
+	case []interface{}:
+		return d.encodeValue(buf, &Array{elements: t}, depth)
+	case *Array:
+		if len(t.elements) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		l := d.effectiveLayout(t.layout)
+		buf.WriteByte('[')
+		for i, elem := range t.elements {
+			d.separator(buf, l, i, depth+1)
+			if err := d.encodeValue(buf, elem, depth+1); err != nil {
+				return err
+			}
+		}
+		d.newline(buf, l, depth)
+		buf.WriteByte(']')
+	case *Object:
+		if len(t.keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		l := d.effectiveLayout(t.layout)
+		buf.WriteByte('{')
+		for i, k := range t.keys {
+			d.separator(buf, l, i, depth+1)
+			if err := encodeScalar(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if !l.inline || l.spaced {
+				buf.WriteByte(' ')
+			}
+			if err := d.encodeValue(buf, t.values[k], depth+1); err != nil {
+				return err
+			}
+		}
+		d.newline(buf, l, depth)
+		buf.WriteByte('}')
+	default:
+		return encodeScalar(buf, v)
+	}
+
+	return nil
+}
+
+// effectiveLayout returns the layout to use for an array or object. Without
+// any indentation, everything has to be on a single line.
+func (d *Document) effectiveLayout(l layout) layout {
+	if d.Indent == "" {
+		l.inline = true
+	}
+	return l
+}
+
+func (d *Document) separator(buf *bytes.Buffer, l layout, i, depth int) {
+	if i > 0 {
+		buf.WriteByte(',')
+		if l.inline && l.spaced {
+			buf.WriteByte(' ')
+		}
+	}
+	d.newline(buf, l, depth)
+}
+
+func (d *Document) newline(buf *bytes.Buffer, l layout, depth int) {
+	if l.inline {
+		return
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(strings.Repeat(d.Indent, depth))
+}
+
+func encodeScalar(buf *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(buf)
+	// We don't want to turn characters like "<" into "\u003c".
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	// The encoder always adds a newline.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
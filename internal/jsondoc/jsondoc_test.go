@@ -0,0 +1,79 @@
+package jsondoc
+
+import (
+	"testing"
+
+	"github.com/houseabsolute/detest/pkg/detest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		"two spaces": `{
+  "zed": [
+    1,
+    2.50,
+    "<a & b>"
+  ],
+  "alpha": {
+    "nested": true,
+    "empty": {},
+    "none": []
+  },
+  "null": null
+}
+`,
+		"tabs": "[\n\t{\n\t\t\"a\": \"b\"\n\t}\n]",
+		"inline containers": `{
+    "ports": [443, 22],
+    "limits": {"max":10,"min":1},
+    "hosts": [
+        {"name": "a, b: c", "ip": "10.0.0.1"},
+        []
+    ]
+}`,
+		"spaced single line": `{"b": [3, 1, 2], "a": {"c": null}}`,
+		"compact":            `{"b":[3,1,2],"a":{"c":null}}`,
+		"scalar":             "\"just a string\"\n",
+	}
+
+	for name, doc := range tests {
+		name, doc := name, doc
+		t.Run(name, func(t *testing.T) {
+			d := detest.New(t)
+
+			decoded, err := Decode([]byte(doc))
+			d.Require(d.Is(err, nil, "no error decoding document"))
+
+			encoded, err := decoded.Encode()
+			d.Require(d.Is(err, nil, "no error encoding document"))
+			d.Is(string(encoded), doc, "document round trips")
+		})
+	}
+}
+
+func TestDecodeKeepsKeyOrder(t *testing.T) {
+	d := detest.New(t)
+
+	decoded, err := Decode([]byte(`{"z": 1, "a": 2, "m": 3}`))
+	d.Require(d.Is(err, nil, "no error decoding document"))
+
+	obj, ok := decoded.Value.(*Object)
+	d.Require(d.Is(ok, true, "document is an *Object"))
+	d.Is(obj.Keys(), []string{"z", "a", "m"}, "keys are in document order")
+}
+
+func TestDecodeErrors(t *testing.T) {
+	d := detest.New(t)
+
+	_, err := Decode([]byte(`{"a": 1} {"b": 2}`))
+	d.Is(err.Error(), "the document contains more than one JSON value", "error for two values")
+
+	_, err = Decode([]byte(`{"a": }`))
+	d.IsNot(err, nil, "error for invalid JSON")
+
+	_, err = Decode([]byte(`{"a": 1, "b": {"c": 2, "c": 3}}`))
+	d.Is(err.Error(), `the key "c" appears more than once in the same object`, "error for a repeated key")
+
+	_, err = Decode([]byte(`[{"a": 1}, {"a": 2}]`))
+	d.Is(err, nil, "no error for the same key in different objects")
+}
@@ -0,0 +1,271 @@
+// Package jsonpath implements simple paths into decoded JSON values. A path
+// looks like ".meta.ip", ".hosts[0]", or `.["key.with.dots"]`. The path "."
+// refers to the whole value. A "*" or "[*]" segment matches every value in
+// an object or array.
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment is one step in a path. It is either an object key, an array
+// index, or a wildcard.
+type Segment struct {
+	Key        string
+	Index      int
+	IsIndex    bool
+	IsWildcard bool
+}
+
+// Object is implemented by JSON object types which keep track of the order
+// of their keys. Paths can look up values in an Object as well as in a
+// map[string]interface{}.
+type Object interface {
+	Keys() []string
+	Get(key string) (interface{}, bool)
+	Set(key string, v interface{})
+}
+
+// Array is implemented by JSON array types which keep more than just their
+// elements. Paths can look up values in an Array as well as in a
+// []interface{}.
+type Array interface {
+	Elements() []interface{}
+}
+
+// Path is a parsed path expression.
+type Path struct {
+	expr     string
+	segments []Segment
+}
+
+// Parse parses a path expression.
+func Parse(expr string) (Path, error) {
+	p := Path{expr: expr}
+
+	if !strings.HasPrefix(expr, ".") && !strings.HasPrefix(expr, "[") {
+		return p, fmt.Errorf("the path %q must start with '.' or '['", expr)
+	}
+	if expr == "." {
+		return p, nil
+	}
+
+	rest := expr
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			// This allows for `.["key"]`.
+			if strings.HasPrefix(rest, "[") {
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return p, fmt.Errorf("the path %q contains an empty key", expr)
+			}
+			key := rest[:end]
+			p.segments = append(p.segments, Segment{Key: key, IsWildcard: key == "*"})
+			rest = rest[end:]
+		case '[':
+			end := closingBracket(rest)
+			if end == -1 {
+				return p, fmt.Errorf("the path %q contains an unclosed '['", expr)
+			}
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return p, fmt.Errorf("the path %q is invalid: %w", expr, err)
+			}
+			p.segments = append(p.segments, seg)
+			rest = rest[end+1:]
+		default:
+			return p, fmt.Errorf("the path %q has an unexpected character at %q", expr, rest)
+		}
+	}
+
+	return p, nil
+}
+
+// closingBracket returns the index of the ']' that closes the '[' at the
+// start of s, skipping over a quoted key.
+func closingBracket(s string) int {
+	if len(s) > 1 && s[1] == '"' {
+		for i := 2; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				if i+1 < len(s) && s[i+1] == ']' {
+					return i + 1
+				}
+				return -1
+			}
+		}
+		return -1
+	}
+
+	return strings.IndexByte(s, ']')
+}
+
+func parseBracket(inner string) (Segment, error) {
+	if strings.HasPrefix(inner, `"`) {
+		key, err := strconv.Unquote(inner)
+		if err != nil {
+			return Segment{}, fmt.Errorf("%s is not a valid quoted key", inner)
+		}
+		return Segment{Key: key}, nil
+	}
+
+	if inner == "*" {
+		return Segment{IsWildcard: true}, nil
+	}
+
+	idx, err := strconv.Atoi(inner)
+	if err != nil || idx < 0 {
+		return Segment{}, fmt.Errorf("[%s] is not a valid array index", inner)
+	}
+	return Segment{Index: idx, IsIndex: true}, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(expr string) Path {
+	p, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Lookup returns the value at the path in a value decoded by the
+// encoding/json package. The second return value is false if there is
+// nothing at the path. If the path contains wildcards, this returns the
+// first value that matches.
+func (p Path) Lookup(v interface{}) (interface{}, bool) {
+	found := p.Select(v)
+	if len(found) == 0 {
+		return nil, false
+	}
+	return found[0], true
+}
+
+// Select returns every value that matches the path.
+func (p Path) Select(v interface{}) []interface{} {
+	found := []interface{}{v}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, f := range found {
+			next = append(next, seg.apply(f)...)
+		}
+		found = next
+	}
+
+	return found
+}
+
+func (seg Segment) apply(v interface{}) []interface{} {
+	if a, ok := v.(Array); ok {
+		v = a.Elements()
+	}
+
+	switch t := v.(type) {
+	case []interface{}:
+		if seg.IsWildcard {
+			return t
+		}
+		if seg.IsIndex && seg.Index < len(t) {
+			return []interface{}{t[seg.Index]}
+		}
+	case map[string]interface{}:
+		if seg.IsWildcard {
+			values := make([]interface{}, 0, len(t))
+			for _, val := range t {
+				values = append(values, val)
+			}
+			return values
+		}
+		if val, ok := t[seg.Key]; ok && !seg.IsIndex {
+			return []interface{}{val}
+		}
+	case Object:
+		if seg.IsWildcard {
+			values := make([]interface{}, 0, len(t.Keys()))
+			for _, k := range t.Keys() {
+				val, _ := t.Get(k)
+				values = append(values, val)
+			}
+			return values
+		}
+		if val, ok := t.Get(seg.Key); ok && !seg.IsIndex {
+			return []interface{}{val}
+		}
+	}
+
+	return nil
+}
+
+// Update calls f for every value that matches the path and replaces that
+// value with the one f returns. It returns the new root value, which is
+// only different from v when the path is ".".
+//
+// Arrays, Objects, and []interface{} values are updated in place, but values in a
+// map[string]interface{} cannot be replaced.
+func (p Path) Update(v interface{}, f func(interface{}) (interface{}, error)) (interface{}, error) {
+	return update(v, p.segments, f)
+}
+
+func update(v interface{}, segments []Segment, f func(interface{}) (interface{}, error)) (interface{}, error) {
+	if len(segments) == 0 {
+		return f(v)
+	}
+
+	seg := segments[0]
+	elements := v
+	if a, ok := v.(Array); ok {
+		// This updates the Array in place, since the slice shares its
+		// backing array.
+		elements = a.Elements()
+	}
+
+	switch t := elements.(type) {
+	case []interface{}:
+		for i := range t {
+			if !seg.IsWildcard && (!seg.IsIndex || seg.Index != i) {
+				continue
+			}
+			newVal, err := update(t[i], segments[1:], f)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = newVal
+		}
+	case Object:
+		for _, k := range t.Keys() {
+			if seg.IsIndex || (!seg.IsWildcard && seg.Key != k) {
+				continue
+			}
+			val, _ := t.Get(k)
+			newVal, err := update(val, segments[1:], f)
+			if err != nil {
+				return nil, err
+			}
+			t.Set(k, newVal)
+		}
+	}
+
+	return v, nil
+}
+
+// Segments returns the steps in the path. This lets callers walk trees other
+// than decoded JSON values, such as YAML documents.
+func (p Path) Segments() []Segment {
+	return p.segments
+}
+
+// String returns the path's original expression.
+func (p Path) String() string {
+	return p.expr
+}
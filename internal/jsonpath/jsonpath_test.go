@@ -0,0 +1,127 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/houseabsolute/detest/pkg/detest"
+)
+
+const doc = `{
+  "id": 42,
+  "meta": { "ip": "10.0.0.1", "tags": ["a", "b"] },
+  "key.with.dots": true,
+  "nothing": null
+}`
+
+func TestLookup(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(doc), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr   string
+		expect interface{}
+		found  bool
+	}{
+		{".", v, true},
+		{".id", float64(42), true},
+		{".meta.ip", "10.0.0.1", true},
+		{".meta.tags[1]", "b", true},
+		{`.meta["tags"][0]`, "a", true},
+		{`.["key.with.dots"]`, true, true},
+		{".nothing", nil, true},
+		{".missing", nil, false},
+		{".meta.tags[2]", nil, false},
+		{".id.foo", nil, false},
+		{".meta[0]", nil, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.expr, func(t *testing.T) {
+			d := detest.New(t)
+
+			p, err := Parse(test.expr)
+			d.Require(d.Is(err, nil, "no error parsing path"))
+
+			got, found := p.Lookup(v)
+			d.Is(found, test.found, "found matches expectation")
+			d.Is(got, test.expect, "got expected value")
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"id":        `the path "id" must start with '.' or '['`,
+		".a..b":     `the path ".a..b" contains an empty key`,
+		".a[0":      `the path ".a[0" contains an unclosed '['`,
+		".a[x]":     `the path ".a[x]" is invalid: [x] is not a valid array index`,
+		".a[-1]":    `the path ".a[-1]" is invalid: [-1] is not a valid array index`,
+		`.["a]`:     `the path ".[\"a]" contains an unclosed '['`,
+		`.a[0]b`:    `the path ".a[0]b" has an unexpected character at "b"`,
+		`.a["b"]"c`: `the path ".a[\"b\"]\"c" has an unexpected character at "\"c"`,
+	}
+
+	for expr, expect := range tests {
+		expr, expect := expr, expect
+		t.Run(expr, func(t *testing.T) {
+			d := detest.New(t)
+
+			_, err := Parse(expr)
+			if d.IsNot(err, nil, "got an error parsing path") {
+				d.Is(err.Error(), expect, "got expected error")
+			}
+		})
+	}
+}
+
+func TestSelectWithWildcards(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(`{"servers": [{"hosts": ["a", "b"]}, {"hosts": ["c"]}, {"other": 1}]}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := detest.New(t)
+	d.Is(
+		MustParse(".servers[*].hosts").Select(v),
+		[]interface{}{
+			[]interface{}{"a", "b"},
+			[]interface{}{"c"},
+		},
+		"selected every hosts array",
+	)
+	d.Is(
+		MustParse(".servers[*].hosts[*]").Select(v),
+		[]interface{}{"a", "b", "c"},
+		"selected every host",
+	)
+	d.Is(len(MustParse(".servers.*").Select(v)), 3, "a .* wildcard matches array elements too")
+	d.Is(len(MustParse(".servers[*].*").Select(v)), 3, "a .* wildcard matches object values")
+}
+
+func TestUpdate(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(`[["b", "a"], ["d", "c"]]`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := detest.New(t)
+	got, err := MustParse("[*]").Update(v, func(arr interface{}) (interface{}, error) {
+		return arr.([]interface{})[1:], nil
+	})
+	d.Is(err, nil, "no error from Update")
+	d.Is(
+		got,
+		[]interface{}{
+			[]interface{}{"a"},
+			[]interface{}{"c"},
+		},
+		"each array was replaced",
+	)
+}
@@ -0,0 +1,221 @@
+package sorters
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/araddon/dateparse"
+)
+
+// DateOrder determines how the datetime-text approach reads dates like
+// "01/02/2020", where the month and day could be in either order.
+type DateOrder int
+
+const (
+	// DateOrderStrict reads a date as month first or day first if only one
+	// of those makes a valid date, and returns an error if both do and they
+	// are different dates.
+	DateOrderStrict DateOrder = iota
+	// MonthFirst reads "01/02/2020" as January 2.
+	MonthFirst
+	// DayFirst reads "01/02/2020" as February 1.
+	DayFirst
+)
+
+var strftimeDirectives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'f': "000000",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'%': "%",
+}
+
+// DatetimeLayout returns the Go time layout for a format. A format which
+// contains a "%" is treated as a strftime format like "%d/%m/%Y %H:%M" and
+// converted to a layout. Anything else is already a layout, like
+// "02/01/2006 15:04".
+func DatetimeLayout(format string) (string, error) {
+	if strings.TrimSpace(format) == "" {
+		return "", errors.New("a datetime format cannot be empty")
+	}
+	if !strings.Contains(format, "%") {
+		return format, nil
+	}
+
+	var layout strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			layout.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("the datetime format %q ends with a %%", format)
+		}
+		directive, ok := strftimeDirectives[format[i]]
+		if !ok {
+			return "", fmt.Errorf("the datetime format %q contains an unsupported directive, %%%c", format, format[i])
+		}
+		// Go only recognizes fractional seconds after a "." or ",".
+		if format[i] == 'f' && !strings.HasSuffix(layout.String(), ".") && !strings.HasSuffix(layout.String(), ",") {
+			return "", fmt.Errorf("the %%f directive in the datetime format %q must come after a \".\" or \",\"", format)
+		}
+		layout.WriteString(directive)
+	}
+
+	return layout.String(), nil
+}
+
+var utcOffset = regexp.MustCompile(`\A([+-])(\d{2}):?(\d{2})\z`)
+
+// maxUTCOffset is the largest offset from UTC used by any time zone, which is
+// +14:00 in Kiribati.
+const maxUTCOffset = 14 * 60 * 60
+
+// ParseTimezone parses a time zone name like "Europe/Berlin" or "UTC", or an
+// offset from UTC like "+02:00" or "-0500".
+func ParseTimezone(name string) (*time.Location, error) {
+	if m := utcOffset.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		offset := hours*60*60 + minutes*60
+		if minutes >= 60 || offset > maxUTCOffset {
+			return nil, fmt.Errorf("the time zone offset %s is not between -14:00 and +14:00", name)
+		}
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not find a time zone matching %s: %s", name, err)
+	}
+	return loc, nil
+}
+
+// parseDatetime returns the datetime at the start of v. It returns false if
+// v does not start with a datetime.
+func parseDatetime(v string, p SortParams) (time.Time, bool, error) {
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	if len(p.DatetimeLayouts) > 0 {
+		return parseDatetimeWithLayouts(v, p.DatetimeLayouts, loc)
+	}
+
+	prefix, ok := datetimePrefix.match(v)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	t, err := parseGuessedDatetime(prefix, loc, p.DateOrder)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
+
+// parseDatetimeWithLayouts tries each layout in turn against the start of v.
+// Since a layout can contain spaces, we match it against as many fields from
+// v as it has. A line which starts with a digit must match one of the
+// layouts, just as it must be a datetime when the format is guessed.
+func parseDatetimeWithLayouts(v string, layouts []string, loc *time.Location) (time.Time, bool, error) {
+	for _, layout := range layouts {
+		prefix := leadingFields(v, len(strings.Fields(layout)))
+		if t, err := time.ParseInLocation(layout, prefix, loc); err == nil {
+			return t, true, nil
+		}
+	}
+
+	if v != "" && unicode.IsDigit(rune(v[0])) {
+		return time.Time{}, false, fmt.Errorf("the line '%s' does not start with a datetime in any of the given formats", v)
+	}
+	return time.Time{}, false, nil
+}
+
+// leadingFields returns the first n whitespace-separated fields of v,
+// including the whitespace between them.
+func leadingFields(v string, n int) string {
+	inField := false
+	for i, r := range v {
+		switch {
+		case unicode.IsSpace(r) && inField:
+			inField = false
+			n--
+			if n == 0 {
+				return v[:i]
+			}
+		case !unicode.IsSpace(r):
+			inField = true
+		}
+	}
+	return v
+}
+
+// numericDate matches a date like "01.02.2020" or "1-2-20" where the month
+// and day could be in either order.
+var numericDate = regexp.MustCompile(`\A(\d{1,2})([.-])(\d{1,2})([.-])(\d{2}|\d{4})(\D|\z)`)
+
+// parseGuessedDatetime parses a datetime without knowing its format. The
+// dateparse package only lets us pick the order of the month and day for
+// dates separated by "/", so we rewrite dates separated by "." or "-" to
+// use "/" first.
+func parseGuessedDatetime(prefix string, loc *time.Location, order DateOrder) (time.Time, error) {
+	orig := prefix
+	if m := numericDate.FindStringSubmatch(prefix); m != nil && m[2] == m[4] {
+		prefix = m[1] + "/" + m[3] + "/" + m[5] + prefix[len(m[0])-len(m[6]):]
+	}
+
+	monthFirst, monthErr := dateparse.ParseIn(prefix, loc, dateparse.PreferMonthFirst(true))
+	dayFirst, dayErr := dateparse.ParseIn(prefix, loc, dateparse.PreferMonthFirst(false))
+
+	switch order {
+	case MonthFirst:
+		return monthFirst, monthErr
+	case DayFirst:
+		return dayFirst, dayErr
+	}
+
+	switch {
+	case monthErr == nil && dayErr == nil:
+		if !monthFirst.Equal(dayFirst) {
+			return time.Time{}, fmt.Errorf(
+				"the date in '%s' is ambiguous because the month could come before or after the day",
+				orig,
+			)
+		}
+		return monthFirst, nil
+	case monthErr == nil:
+		return monthFirst, nil
+	case dayErr == nil:
+		return dayFirst, nil
+	}
+	return time.Time{}, monthErr
+}
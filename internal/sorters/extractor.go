@@ -0,0 +1,102 @@
+package sorters
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// UnmatchedPolicy determines what happens to values where a Key's Extractor
+// does not find anything to extract.
+type UnmatchedPolicy int
+
+const (
+	// UnmatchedError makes an unmatched value an error.
+	UnmatchedError UnmatchedPolicy = iota
+	// UnmatchedFirst sorts unmatched values before all matched values.
+	UnmatchedFirst
+	// UnmatchedLast sorts unmatched values after all matched values.
+	UnmatchedLast
+)
+
+// Extractor extracts the part of a value that a Key sorts on.
+type Extractor interface {
+	// Extract returns the part of the value to sort on. If there is nothing
+	// to extract it returns a NoMatchError. Any other error is always
+	// fatal, regardless of the Key's UnmatchedPolicy.
+	Extract(value string) (string, error)
+}
+
+// NoMatchError is returned by an Extractor when a value does not contain
+// anything to extract.
+type NoMatchError struct {
+	Message string
+}
+
+func (nme NoMatchError) Error() string {
+	return nme.Message
+}
+
+// KeyRegex extracts a sort key from a value using a regular expression. The
+// key is the capture group named "key" if there is one, otherwise it's the
+// first named capture group, otherwise it's the first capture group. If the
+// regex has no capture groups then the key is the entire match.
+type KeyRegex struct {
+	re    *regexp.Regexp
+	group int
+}
+
+// NewKeyRegex compiles the given expression and returns a new KeyRegex.
+func NewKeyRegex(expr string) (*KeyRegex, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key regex %q: %w", expr, err)
+	}
+
+	return &KeyRegex{
+		re:    re,
+		group: keyGroup(re),
+	}, nil
+}
+
+func mustKeyRegex(expr string) *KeyRegex {
+	kr, err := NewKeyRegex(expr)
+	if err != nil {
+		panic(err)
+	}
+	return kr
+}
+
+func keyGroup(re *regexp.Regexp) int {
+	if i := re.SubexpIndex("key"); i > 0 {
+		return i
+	}
+
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			return i
+		}
+	}
+
+	if re.NumSubexp() > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// Extract implements the Extractor interface.
+func (kr *KeyRegex) Extract(value string) (string, error) {
+	key, ok := kr.match(value)
+	if !ok {
+		return "", NoMatchError{fmt.Sprintf("'%s' does not match the key regex %s", value, kr.re)}
+	}
+	return key, nil
+}
+
+func (kr *KeyRegex) match(value string) (string, bool) {
+	match := kr.re.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+	return match[kr.group], true
+}
@@ -2,14 +2,22 @@ package sorters
 
 import (
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"net/mail"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/araddon/dateparse"
+	"github.com/houseabsolute/omegasort/internal/hostname"
 	"github.com/houseabsolute/omegasort/internal/ip"
 	"github.com/houseabsolute/omegasort/internal/posixpath"
+	"github.com/houseabsolute/omegasort/internal/uid"
 	"github.com/houseabsolute/omegasort/internal/winpath"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/collate"
@@ -31,10 +39,73 @@ type SortParams struct {
 	CaseInsensitive bool
 	Reverse         bool
 	PathType        pathType
+	// NormalizeURLs makes the url approach compare URLs after normalizing
+	// them, so that URLs which only differ in things like default ports or
+	// "." and ".." path segments are equal.
+	NormalizeURLs bool
+	// Ports determines whether the ip approach allows, requires, or forbids
+	// a port after each address.
+	Ports PortPolicy
+	// IPFamilies determines whether the ip approach puts IPv4 and IPv6
+	// addresses in separate groups.
+	IPFamilies IPFamilyOrder
+	// MappedAsIPv4 makes the ip approach treat IPv4-mapped IPv6 addresses,
+	// like "::ffff:10.0.0.1", as the IPv4 addresses they map to.
+	MappedAsIPv4 bool
+	// UUIDTimeOrder makes the uuid approach sort v1, v6, and v7 UUIDs by
+	// the timestamp embedded in them.
+	UUIDTimeOrder bool
+	// DatetimeLayouts are the Go time layouts that the datetime-text
+	// approach tries, in order. If this is empty, the format of each
+	// datetime is guessed.
+	DatetimeLayouts []string
+	// Location is the time zone used by the datetime-text approach for
+	// datetimes without one. If this is nil, the local time zone is used.
+	Location *time.Location
+	// DateOrder determines how the datetime-text approach reads a guessed
+	// date when the month and day could be in either order.
+	DateOrder DateOrder
 }
 
-type sortFunc func(i, j int) bool
-type sortFuncMaker func(lines *[]string, p SortParams) (sortFunc, *error)
+// IPFamilyOrder determines how IPv4 and IPv6 addresses are ordered
+// relative to each other.
+type IPFamilyOrder int
+
+const (
+	// IPFamiliesMixed sorts each IPv4 address as if it were the
+	// IPv4-mapped IPv6 address for it, so "1.2.3.4" sorts like
+	// "::ffff:1.2.3.4", after "::1" and before "2001:db8::1".
+	IPFamiliesMixed IPFamilyOrder = iota
+	// IPv4First sorts every IPv4 address before every IPv6 address.
+	IPv4First
+	// IPv6First sorts every IPv6 address before every IPv4 address.
+	IPv6First
+)
+
+// PortPolicy determines whether IP addresses can have a port.
+type PortPolicy int
+
+const (
+	// PortsAllowed lets each address have a port or not.
+	PortsAllowed PortPolicy = iota
+	// PortsRequired makes an address without a port an error.
+	PortsRequired
+	// PortsForbidden makes an address with a port an error.
+	PortsForbidden
+)
+
+// compareFunc compares the values at indexes i and j. It returns a negative
+// number if i sorts before j, a positive number if i sorts after j, and 0 if
+// they are equal.
+type compareFunc func(i, j int) int
+
+// compareFuncMaker parses all of the values up front and returns a
+// compareFunc for them. If any value cannot be parsed it returns a
+// ParseError.
+//
+// A compareFunc never looks at p.Reverse. Reversing the order is handled by
+// the Sorter so that each key in a chain can have its own direction.
+type compareFuncMaker func(values []string, p SortParams) (compareFunc, error)
 
 // Approach defines a single sorting approach.
 type Approach struct {
@@ -42,7 +113,11 @@ type Approach struct {
 	Description      string
 	SupportsLocale   bool
 	SupportsPathType bool
-	MakeSortFunc     sortFuncMaker
+	MakeCompareFunc  compareFuncMaker
+	// Canonicalize returns the canonical form of a value, for approaches
+	// where a value can be written more than one way. This is nil for
+	// approaches which don't have a canonical form.
+	Canonicalize func(string) (string, error)
 }
 
 // AvailableSorts is a slice where each member is an Approach defining a
@@ -54,6 +129,7 @@ var AvailableSorts = []Approach{
 		true,
 		false,
 		textSort,
+		nil,
 	},
 	{
 		"numbered-text",
@@ -62,6 +138,7 @@ var AvailableSorts = []Approach{
 		true,
 		false,
 		numberedTextSort,
+		nil,
 	},
 	{
 		"datetime-text",
@@ -70,6 +147,7 @@ var AvailableSorts = []Approach{
 		true,
 		false,
 		datetimeTextSort,
+		nil,
 	},
 	{
 		"path",
@@ -78,174 +156,501 @@ var AvailableSorts = []Approach{
 		true,
 		true,
 		pathSort,
+		nil,
 	},
 	{
 		"ip",
-		"Sort the file assuming that each line is an IP address.",
+		"Sort the file assuming that each line is an IP address, optionally with a zone and port.",
 		false,
 		false,
 		ipSort,
+		canonicalIP,
 	},
 	{
 		"network",
-		"Sort the file assuming that each line is a network in CIDR form.",
+		"Sort the file assuming that each line is a network in CIDR form, a range of addresses, or an IPv4" +
+			" address with a netmask or wildcard mask.",
 		false,
 		false,
 		networkSort,
+		canonicalNetwork,
+	},
+	{
+		"hostname",
+		"Sort the file assuming that each line is a hostname," +
+			" comparing labels from the top-level domain inward.",
+		false,
+		false,
+		hostnameSort,
+		nil,
+	},
+	{
+		"email",
+		"Sort the file assuming that each line is an email address," +
+			" sorted by the domain and then the local part.",
+		false,
+		false,
+		emailSort,
+		nil,
+	},
+	{
+		"url",
+		"Sort the file assuming that each line is a URL, sorted by the scheme, host, port, path," +
+			" and query parameters.",
+		false,
+		false,
+		urlSort,
+		nil,
+	},
+	{
+		"ip-or-network",
+		"Sort the file assuming that each line is an IP address or a network in CIDR form. Addresses are sorted as" +
+			" if they were a /32 or /128 network.",
+		false,
+		false,
+		ipOrNetworkSort,
+		canonicalIPOrNetwork,
+	},
+	{
+		"mac",
+		"Sort the file assuming that each line is a MAC address or EUI-64, in colon, hyphen, dotted, or bare hex" +
+			" form.",
+		false,
+		false,
+		macSort,
+		canonicalMAC,
+	},
+	{
+		"uuid",
+		"Sort the file assuming that each line is a UUID, sorted by its 128-bit value.",
+		false,
+		false,
+		uuidSort,
+		canonicalUUID,
+	},
+	{
+		"ulid",
+		"Sort the file assuming that each line is a ULID, sorted by its timestamp and then its random part.",
+		false,
+		false,
+		ulidSort,
+		canonicalULID,
 	},
 }
 
-func textSort(lines *[]string, p SortParams) (sortFunc, *error) {
-	comparer := stringComparer(p.Locale, p.CaseInsensitive, p.Reverse)
-	var err error
-	return func(i, j int) bool { return comparer((*lines)[i], (*lines)[j]) }, &err
+// ApproachByName returns the Approach with the given name. The second return
+// value is false if there is no such approach.
+func ApproachByName(name string) (Approach, bool) {
+	for _, as := range AvailableSorts {
+		if as.Name == name {
+			return as, true
+		}
+	}
+	return Approach{}, false
 }
 
-var numberedTextRE = regexp.MustCompile(`\A([0-9]+(?:\.[0-9]+)?)?(.+)\z`)
+// ParseError is returned when a value cannot be parsed by the approach used
+// to sort it.
+type ParseError struct {
+	// Index is the 0-based index of the value that could not be parsed.
+	Index int
+	Err   error
+}
 
-func numberedTextSort(lines *[]string, p SortParams) (sortFunc, *error) {
-	comparer := stringComparer(p.Locale, p.CaseInsensitive, p.Reverse)
-	var err error
+func (pe ParseError) Error() string {
+	return fmt.Sprintf("%s at line %d", pe.Err, pe.Index+1)
+}
+
+func (pe ParseError) Unwrap() error {
+	return pe.Err
+}
+
+// Key is a single key in a chain of sort keys. Values are compared by each
+// key in turn, and later keys are only used to break ties in earlier keys.
+type Key struct {
+	// Field is the 1-based, whitespace-separated field that this key is
+	// taken from. If this is 0 then the whole value is used.
+	Field int
+	// Extractor, if set, is applied to the value before the field is taken,
+	// so the field is a field of the extracted text rather than of the
+	// value.
+	Extractor Extractor
+	// Unmatched determines what happens to values where the Extractor does
+	// not find anything.
+	Unmatched UnmatchedPolicy
+	Approach  Approach
+	Params    SortParams
+}
 
-	return func(i, j int) bool {
+// extract returns the part of the value that this key sorts on. If fields
+// is not nil then it contains the value's fields.
+func (k Key) extract(value string, fields []string) (string, error) {
+	if fields != nil {
+		if k.Field != 0 {
+			value = nthField(fields, k.Field)
+		}
+		return k.applyExtractor(value)
+	}
+
+	value, err := k.applyExtractor(value)
+	if err != nil || k.Field == 0 {
+		return value, err
+	}
+	return nthField(strings.Fields(value), k.Field), nil
+}
+
+func (k Key) applyExtractor(value string) (string, error) {
+	if k.Extractor == nil {
+		return value, nil
+	}
+	return k.Extractor.Extract(value)
+}
+
+func nthField(fields []string, n int) string {
+	if n > len(fields) {
+		return ""
+	}
+	return fields[n-1]
+}
+
+// Sorter sorts values using a chain of keys.
+type Sorter struct {
+	keys []Key
+}
+
+// NewSorter returns a Sorter for the given keys. There must be at least one
+// key.
+func NewSorter(keys ...Key) *Sorter {
+	return &Sorter{keys: keys}
+}
+
+// Keys parses the given values for each of the sorter's keys.
+func (s *Sorter) Keys(values []string) (*Keys, error) {
+	return s.FieldKeys(values, nil)
+}
+
+// FieldKeys is like Keys, but it is used when each value has already been
+// split into fields, as in a CSV file. A Key's Field is an index into the
+// given fields instead of the value's whitespace-separated fields, and a
+// Key's Extractor is applied to the field rather than to the whole value. A key
+// with a Field of 0 uses the value itself.
+func (s *Sorter) FieldKeys(values []string, fields [][]string) (*Keys, error) {
+	k := &Keys{
+		len:  len(values),
+		keys: make([]parsedKey, len(s.keys)),
+	}
+
+	for x, key := range s.keys {
+		pk, err := parseKey(key, values, fields)
 		if err != nil {
-			return false
+			return nil, err
 		}
+		k.keys[x] = pk
+	}
 
-		matchI := numberedTextRE.FindStringSubmatch((*lines)[i])
-		matchJ := numberedTextRE.FindStringSubmatch((*lines)[j])
+	return k, nil
+}
 
-		var less *bool
-		switch {
-		case matchI[1] != "" && matchJ[1] != "":
-			numI, errI := strconv.ParseFloat(matchI[1], 64)
-			numJ, errJ := strconv.ParseFloat(matchJ[1], 64)
-			if errI == nil && errJ == nil && numI != numJ {
-				less = boolPointer(numI < numJ)
-			}
-			if errI != nil {
-				err = errI
-			} else if errJ != nil {
-				err = errJ
-			}
-		case matchI[1] != "":
-			less = boolPointer(true)
-		case matchJ[1] != "":
-			less = boolPointer(false)
-		}
-		if less != nil {
-			if p.Reverse {
-				return !*less
+func parseKey(key Key, values []string, fields [][]string) (parsedKey, error) {
+	pk := parsedKey{reverse: key.Params.Reverse}
+
+	if key.Field == 0 && key.Extractor == nil {
+		compare, err := key.Approach.MakeCompareFunc(values, key.Params)
+		if err != nil {
+			return pk, err
+		}
+		pk.compare = compare
+		return pk, nil
+	}
+
+	// The approach only sees the values that the extractor matched, so we
+	// need to map between indexes in the original values and the matched
+	// ones.
+	extracted := make([]string, 0, len(values))
+	pk.index = make([]int, len(values))
+	origIndex := make([]int, 0, len(values))
+	for i, v := range values {
+		var f []string
+		if fields != nil {
+			f = fields[i]
+		}
+		e, err := key.extract(v, f)
+		if err != nil {
+			var nme NoMatchError
+			if !errors.As(err, &nme) || key.Unmatched == UnmatchedError {
+				return pk, ParseError{i, err}
 			}
-			return *less
+			pk.index[i] = -1
+			continue
+		}
+		pk.index[i] = len(extracted)
+		extracted = append(extracted, e)
+		origIndex = append(origIndex, i)
+	}
+
+	compare, err := key.Approach.MakeCompareFunc(extracted, key.Params)
+	if err != nil {
+		var pe ParseError
+		if errors.As(err, &pe) {
+			pe.Index = origIndex[pe.Index]
+			return pk, pe
 		}
+		return pk, err
+	}
+	pk.compare = compare
+	pk.unmatched = key.Unmatched
 
-		return comparer(matchI[2], matchJ[2])
-	}, &err
+	return pk, nil
 }
 
-var datetimeTextRE = regexp.MustCompile(`\A(\d\S+)(?:\s*|\z)`)
+// Sort returns a sorted copy of the given values.
+func (s *Sorter) Sort(values []string) ([]string, error) {
+	k, err := s.Keys(values)
+	if err != nil {
+		return nil, err
+	}
 
-func datetimeTextSort(lines *[]string, p SortParams) (sortFunc, *error) {
-	comparer := stringComparer(p.Locale, p.CaseInsensitive, p.Reverse)
-	var err error
+	sorted := make([]string, len(values))
+	for i, idx := range k.Order() {
+		sorted[i] = values[idx]
+	}
+	return sorted, nil
+}
 
-	return func(i, j int) bool {
-		if err != nil {
-			return false
+// Keys contains the parsed sort keys for a set of values. The values
+// themselves are referred to by their index in the original slice.
+type Keys struct {
+	len  int
+	keys []parsedKey
+}
+
+type parsedKey struct {
+	compare compareFunc
+	reverse bool
+	// If this is not nil then it maps indexes in the original values to the
+	// indexes passed to compare. Values where the key's extractor found
+	// nothing are mapped to -1.
+	index     []int
+	unmatched UnmatchedPolicy
+}
+
+func (pk parsedKey) compareIndexes(i, j int) int {
+	if pk.index == nil {
+		return pk.maybeReverse(pk.compare(i, j))
+	}
+
+	i, j = pk.index[i], pk.index[j]
+	// Unmatched values always go at the start or end, regardless of
+	// whether the key is reversed.
+	if c := compareOptional(i != -1, j != -1); c != 0 {
+		if pk.unmatched == UnmatchedFirst {
+			return -c
 		}
+		return c
+	}
+	if i == -1 {
+		return 0
+	}
+
+	return pk.maybeReverse(pk.compare(i, j))
+}
 
-		matchI := datetimeTextRE.FindStringSubmatch((*lines)[i])
-		matchJ := datetimeTextRE.FindStringSubmatch((*lines)[j])
+func (pk parsedKey) maybeReverse(c int) int {
+	if pk.reverse {
+		return -c
+	}
+	return c
+}
 
-		var less *bool
-		switch {
-		case len(matchI) > 0 && len(matchJ) > 0 && matchI[1] != "" && matchJ[1] != "":
-			timeI, errI := dateparse.ParseStrict(matchI[1])
-			timeJ, errJ := dateparse.ParseStrict(matchJ[1])
-			if errI == nil && errJ == nil && !timeI.Equal(timeJ) {
-				less = boolPointer(timeI.Before(timeJ))
-			}
-			if errI != nil {
-				err = errI
-			} else if errJ != nil {
-				err = errJ
-			}
-		case len(matchI) > 0 && matchI[1] != "":
-			less = boolPointer(true)
-		case len(matchJ) > 0 && matchJ[1] != "":
-			less = boolPointer(false)
-		}
-		if less != nil {
-			if p.Reverse {
-				return !*less
-			}
-			return *less
+// Compare compares the values at indexes i and j using each key in turn. It
+// returns a negative number if i sorts before j, a positive number if i sorts
+// after j, and 0 if they are equal for every key.
+func (k *Keys) Compare(i, j int) int {
+	for _, pk := range k.keys {
+		if c := pk.compareIndexes(i, j); c != 0 {
+			return c
 		}
+	}
 
-		return comparer((*lines)[i], (*lines)[j])
-	}, &err
+	return 0
 }
 
-func pathSort(lines *[]string, p SortParams) (sortFunc, *error) {
-	comparer := stringComparer(p.Locale, p.CaseInsensitive, p.Reverse)
-	var err error
+// Order returns the indexes of the values in sorted order. The sort is
+// stable, so values which compare as equal keep their original order.
+func (k *Keys) Order() []int {
+	order := make([]int, k.len)
+	for i := range order {
+		order[i] = i
+	}
 
-	return func(i, j int) bool {
-		var less *bool
-		// Absolute paths sort before relative
-		if isAbs((*lines)[i], p.PathType) && !isAbs((*lines)[j], p.PathType) {
-			less = boolPointer(true)
-		} else if !isAbs((*lines)[i], p.PathType) && isAbs((*lines)[j], p.PathType) {
-			less = boolPointer(false)
-		}
-		if less != nil {
-			if p.Reverse {
-				return !*less
+	sort.SliceStable(order, func(a, b int) bool {
+		return k.Compare(order[a], order[b]) < 0
+	})
+
+	return order
+}
+
+// IsSorted returns true if the values are already in sorted order.
+func (k *Keys) IsSorted() bool {
+	for i := 1; i < k.len; i++ {
+		if k.Compare(i-1, i) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func textSort(values []string, p SortParams) (compareFunc, error) {
+	normalize, compare := stringComparer(p.Locale, p.CaseInsensitive)
+
+	normalized := make([]string, len(values))
+	for i, v := range values {
+		normalized[i] = normalize(v)
+	}
+
+	return func(i, j int) int { return compare(normalized[i], normalized[j]) }, nil
+}
+
+var numberPrefix = mustKeyRegex(`\A[0-9]+(?:\.[0-9]+)?`)
+
+type numberedText struct {
+	hasNum bool
+	num    float64
+	text   string
+}
+
+func numberedTextSort(values []string, p SortParams) (compareFunc, error) {
+	normalize, compare := stringComparer(p.Locale, p.CaseInsensitive)
+
+	parsed := make([]numberedText, len(values))
+	for i, v := range values {
+		prefix, ok := numberPrefix.match(v)
+		parsed[i].text = normalize(strings.TrimPrefix(v, prefix))
+		if !ok {
+			continue
+		}
+
+		num, err := strconv.ParseFloat(prefix, 64)
+		if err != nil {
+			return nil, ParseError{i, err}
+		}
+		parsed[i].hasNum = true
+		parsed[i].num = num
+	}
+
+	return func(i, j int) int {
+		if c := compareOptional(parsed[i].hasNum, parsed[j].hasNum); c != 0 {
+			return c
+		}
+		if parsed[i].hasNum {
+			if c := compareFloat(parsed[i].num, parsed[j].num); c != 0 {
+				return c
 			}
-			return *less
 		}
 
-		elemI := splitPath((*lines)[i], p.PathType)
-		elemJ := splitPath((*lines)[j], p.PathType)
+		return compare(parsed[i].text, parsed[j].text)
+	}, nil
+}
 
-		if p.PathType == WindowsPaths {
-			iIs := isDriveLetter(elemI[0])
-			jIs := isDriveLetter(elemJ[0])
+var datetimePrefix = mustKeyRegex(`\A(\d\S+)(?:\s*|\z)`)
+
+type datetimeText struct {
+	hasTime bool
+	time    time.Time
+	text    string
+}
+
+func datetimeTextSort(values []string, p SortParams) (compareFunc, error) {
+	normalize, compare := stringComparer(p.Locale, p.CaseInsensitive)
+
+	parsed := make([]datetimeText, len(values))
+	for i, v := range values {
+		parsed[i].text = normalize(v)
+
+		t, ok, err := parseDatetime(v, p)
+		if err != nil {
+			return nil, ParseError{i, err}
+		}
+		parsed[i].hasTime = ok
+		parsed[i].time = t
+	}
+
+	return func(i, j int) int {
+		if c := compareOptional(parsed[i].hasTime, parsed[j].hasTime); c != 0 {
+			return c
+		}
+		if parsed[i].hasTime {
 			switch {
-			case iIs && !jIs:
-				less = boolPointer(true)
-			case !iIs && jIs:
-				less = boolPointer(false)
-			case iIs && jIs && elemI[0] != elemJ[0]:
-				less = boolPointer(elemI[0] < elemJ[0])
+			case parsed[i].time.Before(parsed[j].time):
+				return -1
+			case parsed[i].time.After(parsed[j].time):
+				return 1
 			}
 		}
-		if less != nil {
-			if p.Reverse {
-				return !*less
-			}
-			return *less
+
+		return compare(parsed[i].text, parsed[j].text)
+	}, nil
+}
+
+type path struct {
+	isAbs bool
+	// The raw elements are used to check for drive letters while the
+	// normalized elements are used for the actual comparison.
+	raw        []string
+	normalized []string
+}
+
+func pathSort(values []string, p SortParams) (compareFunc, error) {
+	normalize, compare := stringComparer(p.Locale, p.CaseInsensitive)
+
+	parsed := make([]path, len(values))
+	for i, v := range values {
+		parsed[i].isAbs = isAbs(v, p.PathType)
+		parsed[i].raw = splitPath(v, p.PathType)
+		parsed[i].normalized = make([]string, len(parsed[i].raw))
+		for x, e := range parsed[i].raw {
+			parsed[i].normalized[x] = normalize(e)
 		}
+	}
 
-		if len(elemI) != len(elemJ) {
-			less = boolPointer(len(elemI) < len(elemJ))
+	return func(i, j int) int {
+		pathI := parsed[i]
+		pathJ := parsed[j]
+
+		// Absolute paths sort before relative
+		if c := compareOptional(pathI.isAbs, pathJ.isAbs); c != 0 {
+			return c
 		}
-		if less != nil {
-			if p.Reverse {
-				return !*less
+
+		if p.PathType == WindowsPaths {
+			iIs := isDriveLetter(pathI.raw[0])
+			jIs := isDriveLetter(pathJ.raw[0])
+			if c := compareOptional(iIs, jIs); c != 0 {
+				return c
+			}
+			if iIs && jIs && pathI.raw[0] != pathJ.raw[0] {
+				return strings.Compare(pathI.raw[0], pathJ.raw[0])
 			}
-			return *less
 		}
 
-		for x := range elemI {
-			if elemI[x] != elemJ[x] {
-				return comparer(elemI[x], elemJ[x])
-			}
+		return comparePathElements(pathI.normalized, pathJ.normalized, compare)
+	}, nil
+}
+
+// comparePathElements sorts shallower paths before deeper ones, and then
+// compares paths of the same depth element by element.
+func comparePathElements(i, j []string, compare func(i, j string) int) int {
+	if len(i) != len(j) {
+		return compareInt(len(i), len(j))
+	}
+
+	for x := range i {
+		if c := compare(i[x], j[x]); c != 0 {
+			return c
 		}
+	}
 
-		return true
-	}, &err
+	return 0
 }
 
 func splitPath(path string, typ pathType) []string {
@@ -270,110 +675,696 @@ func isDriveLetter(elem string) bool {
 	return driveLetterRE.MatchString(elem)
 }
 
-func ipSort(lines *[]string, p SortParams) (sortFunc, *error) {
-	var err error
+type ipAddress struct {
+	addr net.IP
+	// mapped is true for an IPv4 address written in IPv6 form, like
+	// "::ffff:10.0.0.1".
+	mapped bool
+	zone   string
+	// port is -1 when there is no port.
+	port int
+}
+
+// isIPv4 returns true if the address is an IPv4 address. An IPv4-mapped
+// address is an IPv6 address unless mappedAsIPv4 is true.
+func (a ipAddress) isIPv4(mappedAsIPv4 bool) bool {
+	return a.addr.To4() != nil && (!a.mapped || mappedAsIPv4)
+}
+
+// String returns the address in the same form that it was parsed from, with
+// IPv6 addresses in the form recommended by RFC 5952.
+func (a ipAddress) String() string {
+	host := a.addr.String()
+	if a.mapped {
+		host = "::ffff:" + host
+	}
+	if a.zone != "" {
+		host += "%" + a.zone
+	}
+
+	if a.port < 0 {
+		return host
+	}
+	if a.mapped || a.addr.To4() == nil {
+		return fmt.Sprintf("[%s]:%d", host, a.port)
+	}
+	return fmt.Sprintf("%s:%d", host, a.port)
+}
 
-	return func(i, j int) bool {
+func ipSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([]ipAddress, len(values))
+	for i, v := range values {
+		addr, err := parseIPAddress(v, p.Ports)
 		if err != nil {
-			return false
+			return nil, ParseError{i, err}
 		}
+		parsed[i] = addr
+	}
 
-		addrI := net.ParseIP((*lines)[i])
-		if addrI == nil {
-			err = fmt.Errorf("invalid IP address '%s' at line %d", (*lines)[i], i+1)
-			return false
+	return func(i, j int) int {
+		addrI := parsed[i]
+		addrJ := parsed[j]
+
+		// The net package stores every address in 16 bytes, with IPv4
+		// addresses in the IPv4-mapped form, so comparing the bytes sorts
+		// IPv4 addresses as if they were IPv4-mapped addresses. If the
+		// families are grouped we have to check the family ourselves.
+		if p.IPFamilies != IPFamiliesMixed {
+			if v4I, v4J := addrI.isIPv4(p.MappedAsIPv4), addrJ.isIPv4(p.MappedAsIPv4); v4I != v4J {
+				if v4I == (p.IPFamilies == IPv4First) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := bytes.Compare(addrI.addr.To16(), addrJ.addr.To16()); c != 0 {
+			return c
 		}
 
-		addrJ := net.ParseIP((*lines)[j])
-		if addrJ == nil {
-			err = fmt.Errorf("invalid IP address '%s' at line %d", (*lines)[j], j+1)
-			return false
+		// An IPv4 address sorts before the same address in the IPv4-mapped
+		// form, unless they're treated as the same address.
+		if !p.MappedAsIPv4 {
+			if c := compareOptional(!addrI.mapped, !addrJ.mapped); c != 0 {
+				return c
+			}
 		}
 
-		var less *bool
-		if len(addrI) != len(addrJ) {
-			less = boolPointer(len(addrI) < len(addrJ))
+		// Addresses without a zone sort before addresses with one.
+		if c := compareOptional(addrI.zone == "", addrJ.zone == ""); c != 0 {
+			return c
 		}
+		if c := strings.Compare(addrI.zone, addrJ.zone); c != 0 {
+			return c
+		}
+
+		return compareInt(addrI.port, addrJ.port)
+	}, nil
+}
 
-		if less == nil {
-			less = boolPointer(bytes.Compare(addrI, addrJ) < 0)
+// parseIPAddress parses an address which may have a zone and a port, like
+// "10.0.0.1:8080", "fe80::1%eth0", or "[2001:db8::1]:443". An IPv6 address
+// must be in brackets to have a port, since otherwise the port would look
+// like part of the address.
+func parseIPAddress(v string, ports PortPolicy) (ipAddress, error) {
+	invalid := fmt.Errorf("invalid IP address '%s'", v)
+
+	host := v
+	port := ""
+	hasPort := false
+	switch {
+	case strings.HasPrefix(v, "["):
+		end := strings.IndexByte(v, ']')
+		if end < 0 {
+			return ipAddress{}, invalid
+		}
+		host = v[1:end]
+		if rest := v[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return ipAddress{}, invalid
+			}
+			port = rest[1:]
+			hasPort = true
 		}
+		if !strings.Contains(host, ":") {
+			return ipAddress{}, invalid
+		}
+	case strings.Count(v, ":") == 1:
+		host, port = splitLast(v, ":")
+		hasPort = true
+	}
 
-		if p.Reverse {
-			return !*less
+	parsed := ipAddress{port: -1}
+	if h, zone := splitLast(host, "%"); h != host {
+		if zone == "" || !strings.Contains(h, ":") {
+			return ipAddress{}, invalid
 		}
-		return *less
-	}, &err
+		host = h
+		parsed.zone = zone
+	}
+
+	parsed.addr = net.ParseIP(host)
+	if parsed.addr == nil {
+		return ipAddress{}, invalid
+	}
+	parsed.mapped = strings.Contains(host, ":") && parsed.addr.To4() != nil
+
+	if hasPort {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 0 || n > 65535 {
+			return ipAddress{}, fmt.Errorf("invalid port in '%s'", v)
+		}
+		parsed.port = n
+	}
+
+	switch {
+	case ports == PortsRequired && parsed.port < 0:
+		return ipAddress{}, fmt.Errorf("the IP address '%s' does not have a port", v)
+	case ports == PortsForbidden && parsed.port >= 0:
+		return ipAddress{}, fmt.Errorf("the IP address '%s' has a port", v)
+	}
+
+	return parsed, nil
 }
 
-func networkSort(lines *[]string, p SortParams) (sortFunc, *error) {
-	var err error
+// splitLast splits s at the last instance of sep. If sep is not in s it
+// returns s and an empty string.
+func splitLast(s, sep string) (string, string) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+len(sep):]
+}
 
-	return func(i, j int) bool {
+// networkSort sorts CIDRs, ranges like "10.0.0.0-10.0.0.255", and
+// addresses with masks like "10.0.0.0 255.255.255.0". All of these are
+// turned into ranges, which are sorted by their start address and then by
+// size, so 10.0.0.0/24 comes before 10.0.0.0/25.
+func networkSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([]ip.Range, len(values))
+	for i, v := range values {
+		r, err := ip.ParseRange(v)
 		if err != nil {
-			return false
+			return nil, ParseError{i, err}
 		}
+		parsed[i] = r
+	}
+
+	return func(i, j int) int {
+		return ip.CompareRanges(parsed[i], parsed[j])
+	}, nil
+}
 
-		var cidrI ip.CIDR
-		cidrI, err = ip.CIDRFromString((*lines)[i])
+// canonicalIP returns an address with IPv6 addresses in the form
+// recommended by RFC 5952, so "2001:DB8:0::1" becomes "2001:db8::1". Zones
+// and ports are kept.
+func canonicalIP(v string) (string, error) {
+	addr, err := parseIPAddress(v, PortsAllowed)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// UnmapIPv4 returns the IPv4 address that an IPv4-mapped IPv6 address maps
+// to, so "::ffff:10.0.0.1" becomes "10.0.0.1". Any port is kept. It returns
+// false if the value is not an IPv4-mapped address, or if it has a zone,
+// since an IPv4 address can't have one.
+func UnmapIPv4(v string) (string, bool) {
+	addr, err := parseIPAddress(v, PortsAllowed)
+	if err != nil || !addr.mapped || addr.zone != "" {
+		return "", false
+	}
+
+	addr.mapped = false
+	return addr.String(), true
+}
+
+// canonicalNetwork returns a network with its host bits cleared and with
+// IPv6 addresses in the form recommended by RFC 5952. Ranges and masked
+// addresses keep their notation, so "10.0.0.5 255.255.255.0" becomes
+// "10.0.0.0 255.255.255.0".
+func canonicalNetwork(v string) (string, error) {
+	r, err := ip.ParseRange(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid network '%s'", v)
+	}
+
+	if strings.Contains(v, "/") {
+		c, _ := r.CIDR()
+		return c.String(), nil
+	}
+	if strings.Contains(v, "-") {
+		return r.String(), nil
+	}
+
+	mask := strings.Fields(v)[1]
+	return fmt.Sprintf("%s %s", r.Start(), net.ParseIP(mask).To4()), nil
+}
+
+func hostnameSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([][]string, len(values))
+	for i, v := range values {
+		labels, err := hostname.Parse(v)
 		if err != nil {
-			return false
+			return nil, ParseError{i, fmt.Errorf("invalid hostname '%s': %w", v, err)}
 		}
+		parsed[i] = labels
+	}
 
-		var cidrJ ip.CIDR
-		cidrJ, err = ip.CIDRFromString((*lines)[j])
+	return func(i, j int) int {
+		return hostname.Compare(parsed[i], parsed[j])
+	}, nil
+}
+
+type emailAddress struct {
+	local  string
+	domain []string
+}
+
+func emailSort(values []string, p SortParams) (compareFunc, error) {
+	normalize, compare := stringComparer(language.Und, p.CaseInsensitive)
+
+	parsed := make([]emailAddress, len(values))
+	for i, v := range values {
+		addr, err := parseEmail(v)
 		if err != nil {
-			return false
+			return nil, ParseError{i, fmt.Errorf("invalid email address '%s': %w", v, err)}
 		}
+		addr.local = normalize(addr.local)
+		parsed[i] = addr
+	}
+
+	return func(i, j int) int {
+		if c := hostname.Compare(parsed[i].domain, parsed[j].domain); c != 0 {
+			return c
+		}
+		return compare(parsed[i].local, parsed[j].local)
+	}, nil
+}
+
+// parseEmail parses a bare address like "foo@example.com" or the first
+// address in angle brackets, as in "Foo <foo@example.com>". A .mailmap line
+// can have two bracketed addresses, and the first one is the one we sort by.
+// Anything outside the brackets is ignored.
+func parseEmail(v string) (emailAddress, error) {
+	addr := strings.TrimSpace(v)
+	if start := strings.IndexByte(v, '<'); start >= 0 {
+		end := strings.IndexByte(v[start:], '>')
+		if end < 0 {
+			return emailAddress{}, errors.New("missing closing '>'")
+		}
+		addr = v[start+1 : start+end]
+	}
+
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return emailAddress{}, errors.New(strings.TrimPrefix(err.Error(), "mail: "))
+	}
+
+	at := strings.LastIndexByte(parsed.Address, '@')
+	domain, err := hostname.Parse(parsed.Address[at+1:])
+	if err != nil {
+		return emailAddress{}, fmt.Errorf("invalid domain: %w", err)
+	}
 
-		addrI := cidrI.Addr().AsNetIP()
-		addrJ := cidrJ.Addr().AsNetIP()
+	return emailAddress{parsed.Address[:at], domain}, nil
+}
+
+type parsedURL struct {
+	scheme string
+	hostIP net.IP
+	// hostIsIPv4 is true if the host is an IPv4 address. An IPv4-mapped
+	// address like "[::ffff:10.0.0.1]" is an IPv6 address, as with the ip
+	// approach.
+	hostIsIPv4 bool
+	host       []string
+	port       int
+	opaque     string
+	path       []string
+	query      []string
+	user       string
+	fragment   string
+}
 
-		var less *bool
-		if len(addrI) != len(addrJ) {
-			less = boolPointer(len(addrI) < len(addrJ))
+func urlSort(values []string, p SortParams) (compareFunc, error) {
+	normalize, compare := stringComparer(language.Und, p.CaseInsensitive)
+
+	parsed := make([]parsedURL, len(values))
+	for i, v := range values {
+		u, err := parseURL(v, p.NormalizeURLs)
+		if err != nil {
+			return nil, ParseError{i, fmt.Errorf("invalid URL '%s': %w", v, err)}
+		}
+		for x := range u.path {
+			u.path[x] = normalize(u.path[x])
 		}
+		parsed[i] = u
+	}
+
+	return func(i, j int) int {
+		urlI := parsed[i]
+		urlJ := parsed[j]
 
-		if less == nil {
-			comp := bytes.Compare(addrI, addrJ)
-			if comp != 0 {
-				less = boolPointer(comp < 0)
+		if c := strings.Compare(urlI.scheme, urlJ.scheme); c != 0 {
+			return c
+		}
+
+		// URLs without a host sort first, then URLs with an IP address,
+		// then URLs with a hostname.
+		hasHostI := urlI.hostIP != nil || urlI.host != nil
+		hasHostJ := urlJ.hostIP != nil || urlJ.host != nil
+		if c := compareOptional(!hasHostI, !hasHostJ); c != 0 {
+			return c
+		}
+		if c := compareOptional(urlI.hostIP != nil, urlJ.hostIP != nil); c != 0 {
+			return c
+		}
+		if urlI.hostIP != nil {
+			// IPv4 addresses sort before IPv6 addresses. The net package
+			// stores both in 16 bytes, so we can't tell them apart by
+			// length.
+			if c := compareOptional(urlI.hostIsIPv4, urlJ.hostIsIPv4); c != 0 {
+				return c
+			}
+			if c := bytes.Compare(urlI.hostIP.To16(), urlJ.hostIP.To16()); c != 0 {
+				return c
 			}
+		} else if c := hostname.Compare(urlI.host, urlJ.host); c != 0 {
+			return c
 		}
 
-		if less == nil {
-			less = boolPointer(cidrI.Prefix() < cidrJ.Prefix())
+		if c := compareInt(urlI.port, urlJ.port); c != 0 {
+			return c
+		}
+		if c := strings.Compare(urlI.opaque, urlJ.opaque); c != 0 {
+			return c
+		}
+		if c := comparePathElements(urlI.path, urlJ.path, compare); c != 0 {
+			return c
 		}
 
-		if p.Reverse {
-			return !*less
+		for x := 0; x < len(urlI.query) && x < len(urlJ.query); x++ {
+			if c := strings.Compare(urlI.query[x], urlJ.query[x]); c != 0 {
+				return c
+			}
+		}
+		if c := compareInt(len(urlI.query), len(urlJ.query)); c != 0 {
+			return c
 		}
-		return *less
-	}, &err
+
+		if c := strings.Compare(urlI.user, urlJ.user); c != 0 {
+			return c
+		}
+		return strings.Compare(urlI.fragment, urlJ.fragment)
+	}, nil
 }
 
-func boolPointer(val bool) *bool {
-	return &val
+var defaultPorts = map[string]int{
+	"ftp":   21,
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
 }
 
-func stringComparer(locale language.Tag, caseInsensitive, reverse bool) func(i, j string) bool {
-	if locale == language.Und {
-		if caseInsensitive {
-			caser := cases.Fold()
-			if reverse {
-				return func(i, j string) bool {
-					return caser.String(i) > caser.String(j)
-				}
+// parseURL parses an absolute URL. The scheme and host are always compared
+// case-insensitively. A URL without a port has a port of -1, so it sorts
+// before URLs with a port.
+//
+// When normalize is true, a default port like 80 for http is removed, an
+// empty path becomes "/", "." and ".." path segments are resolved, and
+// percent-encoding is decoded in path segments and query parameters.
+func parseURL(v string, normalize bool) (parsedURL, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return parsedURL{}, err
+	}
+	if u.Scheme == "" {
+		return parsedURL{}, errors.New("missing scheme")
+	}
+
+	parsed := parsedURL{
+		scheme:   strings.ToLower(u.Scheme),
+		port:     -1,
+		opaque:   u.Opaque,
+		fragment: u.EscapedFragment(),
+	}
+	if u.User != nil {
+		parsed.user = u.User.String()
+	}
+
+	if h := u.Hostname(); h != "" {
+		if addr := net.ParseIP(h); addr != nil {
+			parsed.hostIP = addr
+			parsed.hostIsIPv4 = addr.To4() != nil && !strings.Contains(h, ":")
+		} else {
+			parsed.host, err = hostname.Parse(h)
+			if err != nil {
+				return parsedURL{}, fmt.Errorf("invalid host: %w", err)
+			}
+		}
+	}
+
+	if port := u.Port(); port != "" {
+		parsed.port, err = strconv.Atoi(port)
+		if err != nil {
+			return parsedURL{}, fmt.Errorf("invalid port %q", port)
+		}
+		if normalize && parsed.port == defaultPorts[parsed.scheme] {
+			parsed.port = -1
+		}
+	}
+
+	if parsed.opaque == "" {
+		parsed.path = urlPathSegments(u.EscapedPath(), normalize)
+	}
+
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		if normalize {
+			if unescaped, err := url.QueryUnescape(param); err == nil {
+				param = unescaped
 			}
-			return func(i, j string) bool {
-				return caser.String(i) < caser.String(j)
+		}
+		parsed.query = append(parsed.query, param)
+	}
+	sort.Strings(parsed.query)
+
+	return parsed, nil
+}
+
+// urlPathSegments splits an escaped path into segments. A trailing slash
+// results in an empty last segment, so "/a/" sorts after "/a".
+func urlPathSegments(escaped string, normalize bool) []string {
+	if escaped == "" && !normalize {
+		return nil
+	}
+
+	split := strings.Split(strings.TrimPrefix(escaped, "/"), "/")
+	if !normalize {
+		return split
+	}
+
+	var segments []string
+	for x, seg := range split {
+		// A path that ends in "." or ".." refers to a directory, so it
+		// becomes a path with a trailing slash.
+		isLast := x == len(split)-1
+		switch seg {
+		case ".":
+			if isLast {
+				segments = append(segments, "")
 			}
+			continue
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+			if isLast {
+				segments = append(segments, "")
+			}
+			continue
+		}
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			seg = unescaped
 		}
+		segments = append(segments, seg)
+	}
 
-		if reverse {
-			return func(i, j string) bool { return i > j }
+	return segments
+}
+
+func ipOrNetworkSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([]ip.CIDR, len(values))
+	for i, v := range values {
+		cidr, err := ip.ParseCIDROrIP(v)
+		if err != nil {
+			return nil, ParseError{i, fmt.Errorf("invalid IP address or network '%s'", v)}
+		}
+		parsed[i] = cidr
+	}
+
+	return func(i, j int) int {
+		return ip.Compare(parsed[i], parsed[j])
+	}, nil
+}
+
+// canonicalIPOrNetwork returns the canonical form of an address or network.
+// An address stays an address, rather than becoming a /32 or /128 network.
+func canonicalIPOrNetwork(v string) (string, error) {
+	cidr, err := ip.ParseCIDROrIP(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid IP address or network '%s'", v)
+	}
+	if !strings.Contains(v, "/") {
+		return cidr.Addr().String(), nil
+	}
+	return cidr.String(), nil
+}
+
+// macSort sorts MAC addresses numerically. Shorter addresses sort before
+// longer ones, so every EUI-48 address comes before every EUI-64 address.
+func macSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([]net.HardwareAddr, len(values))
+	for i, v := range values {
+		mac, err := parseMAC(v)
+		if err != nil {
+			return nil, ParseError{i, err}
+		}
+		parsed[i] = mac
+	}
+
+	return func(i, j int) int {
+		if c := compareInt(len(parsed[i]), len(parsed[j])); c != 0 {
+			return c
 		}
-		return func(i, j string) bool { return i < j }
+		return bytes.Compare(parsed[i], parsed[j])
+	}, nil
+}
+
+// parseMAC parses a MAC address in any of the forms that net.ParseMAC
+// accepts, like "00:11:22:33:44:55", "00-11-22-33-44-55", or
+// "0011.2233.4455", or as bare hex, like "001122334455".
+func parseMAC(v string) (net.HardwareAddr, error) {
+	if mac, err := net.ParseMAC(v); err == nil {
+		return mac, nil
+	}
+
+	if len(v) == 12 || len(v) == 16 {
+		if mac, err := hex.DecodeString(v); err == nil {
+			return mac, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid MAC address '%s'", v)
+}
+
+// canonicalMAC returns a MAC address as lowercase hex pairs separated by
+// colons, like "00:11:22:33:44:55".
+func canonicalMAC(v string) (string, error) {
+	mac, err := parseMAC(v)
+	if err != nil {
+		return "", err
+	}
+	return mac.String(), nil
+}
+
+// uuidSort sorts UUIDs by their 128-bit value. If p.UUIDTimeOrder is true,
+// UUIDs with a timestamp are sorted by it first, and come before UUIDs
+// without one.
+func uuidSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([]uid.UUID, len(values))
+	for i, v := range values {
+		u, err := uid.ParseUUID(v)
+		if err != nil {
+			return nil, ParseError{i, fmt.Errorf("invalid UUID '%s': %w", v, err)}
+		}
+		parsed[i] = u
+	}
+
+	return func(i, j int) int {
+		if p.UUIDTimeOrder {
+			timeI, okI := parsed[i].Time()
+			timeJ, okJ := parsed[j].Time()
+			if c := compareOptional(okI, okJ); c != 0 {
+				return c
+			}
+			switch {
+			case timeI < timeJ:
+				return -1
+			case timeI > timeJ:
+				return 1
+			}
+		}
+		return parsed[i].Compare(parsed[j])
+	}, nil
+}
+
+// canonicalUUID returns a UUID in lowercase with hyphens and without braces.
+func canonicalUUID(v string) (string, error) {
+	u, err := uid.ParseUUID(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid UUID '%s': %w", v, err)
+	}
+	return u.String(), nil
+}
+
+func ulidSort(values []string, p SortParams) (compareFunc, error) {
+	parsed := make([]uid.ULID, len(values))
+	for i, v := range values {
+		u, err := uid.ParseULID(v)
+		if err != nil {
+			return nil, ParseError{i, fmt.Errorf("invalid ULID '%s': %w", v, err)}
+		}
+		parsed[i] = u
+	}
+
+	return func(i, j int) int {
+		return parsed[i].Compare(parsed[j])
+	}, nil
+}
+
+// canonicalULID returns a ULID in uppercase.
+func canonicalULID(v string) (string, error) {
+	u, err := uid.ParseULID(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid ULID '%s': %w", v, err)
+	}
+	return u.String(), nil
+}
+
+// compareOptional is used when a value may or may not have some property,
+// like a numeric prefix. Values with the property sort before values
+// without it.
+func compareOptional(i, j bool) int {
+	switch {
+	case i && !j:
+		return -1
+	case !i && j:
+		return 1
+	}
+	return 0
+}
+
+func compareInt(i, j int) int {
+	switch {
+	case i < j:
+		return -1
+	case i > j:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(i, j float64) int {
+	switch {
+	case i < j:
+		return -1
+	case i > j:
+		return 1
+	}
+	return 0
+}
+
+// stringComparer returns a function that normalizes a string before it is
+// compared and a function that compares two normalized strings.
+func stringComparer(locale language.Tag, caseInsensitive bool) (func(string) string, func(i, j string) int) {
+	identity := func(s string) string { return s }
+
+	if locale == language.Und {
+		if caseInsensitive {
+			caser := cases.Fold()
+			return caser.String, strings.Compare
+		}
+
+		return identity, strings.Compare
 	}
 
 	opts := []collate.Option{}
@@ -382,9 +1373,5 @@ func stringComparer(locale language.Tag, caseInsensitive, reverse bool) func(i,
 	}
 
 	coll := collate.New(locale, opts...)
-	if reverse {
-		return func(i, j string) bool { return coll.CompareString(i, j) == 1 }
-	}
-
-	return func(i, j string) bool { return coll.CompareString(i, j) == -1 }
+	return identity, coll.CompareString
 }
@@ -1,8 +1,8 @@
 package sorters
 
 import (
-	"sort"
 	"testing"
+	"time"
 
 	"github.com/houseabsolute/detest/pkg/detest"
 	"golang.org/x/text/language"
@@ -21,10 +21,10 @@ var textSortTests = []testCase{
 		[]string{"go", "bears", "above", "And", "all", "home"},
 		[]string{"And", "above", "all", "bears", "go", "home"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -32,10 +32,10 @@ var textSortTests = []testCase{
 		[]string{"go", "bears", "above", "And", "all", "home"},
 		[]string{"above", "all", "And", "bears", "go", "home"},
 		SortParams{
-			language.Und,
-			true,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -43,10 +43,10 @@ var textSortTests = []testCase{
 		[]string{"go", "bears", "above", "And", "all", "home"},
 		[]string{"home", "go", "bears", "all", "above", "And"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -54,10 +54,10 @@ var textSortTests = []testCase{
 		[]string{"go", "bears", "above", "And", "all", "home"},
 		[]string{"home", "go", "bears", "And", "all", "above"},
 		SortParams{
-			language.Und,
-			true,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -65,10 +65,10 @@ var textSortTests = []testCase{
 		[]string{"go", "bears", "above", "And", "all", "home"},
 		[]string{"above", "all", "And", "bears", "go", "home"},
 		SortParams{
-			language.English,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.English,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -76,10 +76,10 @@ var textSortTests = []testCase{
 		[]string{"go", "bears", "above", "And", "all", "home"},
 		[]string{"home", "go", "bears", "And", "all", "above"},
 		SortParams{
-			language.English,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.English,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -87,11 +87,10 @@ var textSortTests = []testCase{
 		[]string{"zoo", "foo", "öoo"},
 		[]string{"foo", "öoo", "zoo"},
 		SortParams{
-			language.German,
-			false,
-			false,
-
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -99,10 +98,10 @@ var textSortTests = []testCase{
 		[]string{"zoo", "foo", "öoo"},
 		[]string{"zoo", "öoo", "foo"},
 		SortParams{
-			language.German,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -110,10 +109,10 @@ var textSortTests = []testCase{
 		[]string{"zoo", "foo", "öoo"},
 		[]string{"foo", "zoo", "öoo"},
 		SortParams{
-			language.Swedish,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Swedish,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -121,10 +120,10 @@ var textSortTests = []testCase{
 		[]string{"zoo", "foo", "öoo"},
 		[]string{"öoo", "zoo", "foo"},
 		SortParams{
-			language.Swedish,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Swedish,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 }
@@ -144,10 +143,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"120001 go", "0. bears", "15 - above", "5. And", "1. all", "2. home"},
 		[]string{"0. bears", "1. all", "2. home", "5. And", "15 - above", "120001 go"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -155,10 +154,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"120001 go", "0. bears", "15 - above", "5. And", "1. all", "2. home"},
 		[]string{"0. bears", "1. all", "2. home", "5. And", "15 - above", "120001 go"},
 		SortParams{
-			language.Und,
-			true,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -166,10 +165,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"120001 go", "0. bears", "15 - above", "5. And", "1. all", "2. home"},
 		[]string{"120001 go", "15 - above", "5. And", "2. home", "1. all", "0. bears"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -177,10 +176,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"120001 go", "0. bears", "15 - above", "5. And", "1. all", "2. home"},
 		[]string{"120001 go", "15 - above", "5. And", "2. home", "1. all", "0. bears"},
 		SortParams{
-			language.Und,
-			true,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -188,10 +187,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"3. zoo", "1. foo", "2. öoo", "2. zoo"},
 		[]string{"1. foo", "2. öoo", "2. zoo", "3. zoo"},
 		SortParams{
-			language.German,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -199,10 +198,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"3. zoo", "1. foo", "2. öoo", "2. zoo"},
 		[]string{"3. zoo", "2. zoo", "2. öoo", "1. foo"},
 		SortParams{
-			language.German,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -210,10 +209,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"3. zoo", "1. foo", "2. öoo", "2. zoo"},
 		[]string{"1. foo", "2. zoo", "2. öoo", "3. zoo"},
 		SortParams{
-			language.Swedish,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Swedish,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -221,10 +220,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"3. zoo", "1. foo", "2. öoo", "2. zoo"},
 		[]string{"3. zoo", "2. öoo", "2. zoo", "1. foo"},
 		SortParams{
-			language.Swedish,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Swedish,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -232,10 +231,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"10. x", "aloe", "27. bar", "love", "1. hello"},
 		[]string{"1. hello", "10. x", "27. bar", "aloe", "love"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -243,10 +242,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"10. x", "aloe", "27. bar", "love", "1. hello"},
 		[]string{"love", "aloe", "27. bar", "10. x", "1. hello"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -254,10 +253,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"10.1 - x", "27.2314 - bar", "1.00 - hello"},
 		[]string{"1.00 - hello", "10.1 - x", "27.2314 - bar"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -265,10 +264,10 @@ var numberedTextSortTests = []testCase{
 		[]string{"10.1 - x", "27.2314 - bar", "1.00 - hello"},
 		[]string{"27.2314 - bar", "10.1 - x", "1.00 - hello"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 }
@@ -293,10 +292,10 @@ var pathSortTests = []testCase{
 		[]string{"/foo", "/bar", "baz/quux", "a/q", "C:\\", "/X", "/A"},
 		[]string{"/A", "/X", "/bar", "/foo", "C:\\", "a/q", "baz/quux"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -304,10 +303,10 @@ var pathSortTests = []testCase{
 		[]string{"/foo", "/bar", "baz/quux", "a/q", "C:\\", "/X", "/A"},
 		[]string{"/A", "/bar", "/foo", "/X", "C:\\", "a/q", "baz/quux"},
 		SortParams{
-			language.Und,
-			true,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -315,10 +314,10 @@ var pathSortTests = []testCase{
 		[]string{"/foo", "/bar", "baz/quux", "a/q", "C:\\", "/X", "/A"},
 		[]string{"baz/quux", "a/q", "C:\\", "/foo", "/bar", "/X", "/A"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -326,10 +325,10 @@ var pathSortTests = []testCase{
 		[]string{"/foo", "/bar", "baz/quux", "a/q", "C:\\", "/X", "/A"},
 		[]string{"baz/quux", "a/q", "C:\\", "/X", "/foo", "/bar", "/A"},
 		SortParams{
-			language.Und,
-			true,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -337,10 +336,10 @@ var pathSortTests = []testCase{
 		[]string{"/zzz", "/bbb", "/xxx/a", "/aaaaaa/q/r"},
 		[]string{"/bbb", "/zzz", "/xxx/a", "/aaaaaa/q/r"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -348,10 +347,10 @@ var pathSortTests = []testCase{
 		[]string{"/zzz", "/bbb", "/xxx/a", "/aaaaaa/q/r"},
 		[]string{"/aaaaaa/q/r", "/xxx/a", "/zzz", "/bbb"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -359,10 +358,10 @@ var pathSortTests = []testCase{
 		[]string{`C:\foo`, `\a\b`, `\b`, `C:\bar`, `E:\a`, `B:\x`, `C:\a\b\c`, `C:\a\b`},
 		[]string{`B:\x`, `C:\bar`, `C:\foo`, `C:\a\b`, `C:\a\b\c`, `E:\a`, `\b`, `\a\b`},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			WindowsPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        WindowsPaths,
 		},
 	},
 	{
@@ -370,10 +369,10 @@ var pathSortTests = []testCase{
 		[]string{`C:\foo`, `\a\b`, `\b`, `C:\bar`, `E:\a`, `B:\x`, `C:\a\b\c`, `C:\a\b`},
 		[]string{`\a\b`, `\b`, `E:\a`, `C:\a\b\c`, `C:\a\b`, `C:\foo`, `C:\bar`, `B:\x`},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			WindowsPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        WindowsPaths,
 		},
 	},
 	{
@@ -381,10 +380,10 @@ var pathSortTests = []testCase{
 		[]string{"/foo", "/bar", "baz/quux", "/zoo", "/öoo", "a/q", "C:\\", "/X", "/A"},
 		[]string{"/A", "/bar", "/foo", "/öoo", "/X", "/zoo", "C:\\", "a/q", "baz/quux"},
 		SortParams{
-			language.German,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -392,10 +391,10 @@ var pathSortTests = []testCase{
 		[]string{"/foo", "/bar", "baz/quux", "/zoo", "/öoo", "a/q", "C:\\", "/X", "/A"},
 		[]string{"baz/quux", "a/q", "C:\\", "/zoo", "/X", "/öoo", "/foo", "/bar", "/A"},
 		SortParams{
-			language.German,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 }
@@ -415,10 +414,10 @@ var ipSortTests = []testCase{
 		[]string{"1.1.1.1", "0.1.255.255", "123.100.125.242", "1.255.0.0"},
 		[]string{"0.1.255.255", "1.1.1.1", "1.255.0.0", "123.100.125.242"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -426,10 +425,10 @@ var ipSortTests = []testCase{
 		[]string{"1.1.1.1", "0.1.255.255", "123.100.125.242", "1.255.0.0"},
 		[]string{"123.100.125.242", "1.255.0.0", "1.1.1.1", "0.1.255.255"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -437,10 +436,10 @@ var ipSortTests = []testCase{
 		[]string{"::1", "::0", "9876::fe01:1234:457f", "1234::"},
 		[]string{"::0", "::1", "1234::", "9876::fe01:1234:457f"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -448,10 +447,10 @@ var ipSortTests = []testCase{
 		[]string{"::1", "::0", "9876::fe01:1234:457f", "1234::"},
 		[]string{"9876::fe01:1234:457f", "1234::", "::1", "::0"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -459,10 +458,10 @@ var ipSortTests = []testCase{
 		[]string{"::1", "::0", "255.255.255.255", "::1234", "9876::fe01:1234:457f", "1.2.3.4", "1234::"},
 		[]string{"::0", "::1", "::1234", "1.2.3.4", "255.255.255.255", "1234::", "9876::fe01:1234:457f"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -470,10 +469,10 @@ var ipSortTests = []testCase{
 		[]string{"::1", "::0", "255.255.255.255", "::1234", "9876::fe01:1234:457f", "1.2.3.4", "1234::"},
 		[]string{"9876::fe01:1234:457f", "1234::", "255.255.255.255", "1.2.3.4", "::1234", "::1", "::0"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 }
@@ -487,32 +486,153 @@ func Test_ipSort(t *testing.T) {
 	}
 
 	params := SortParams{
-		language.Und,
-		false,
-		false,
-		UnixPaths,
+		Locale:          language.Und,
+		CaseInsensitive: false,
+		Reverse:         false,
+		PathType:        UnixPaths,
 	}
 	lines := []string{"1.2.3.4", "not an ip", "4.3.2.1"}
-	sorter, errRef := ipSort(&lines, params)
-	sort.Slice(lines, sorter)
+	_, err := ipSort(lines, params)
 	d := detest.New(t)
 	d.Is(
-		(*errRef).Error(),
+		err.Error(),
 		"invalid IP address 'not an ip' at line 2",
 		"got expected error when line contains a non-ip",
 	)
 }
 
+func Test_ipSortWithPortsAndZones(t *testing.T) {
+	test := testCase{
+		"IP addresses with ports and zones",
+		[]string{
+			"10.0.0.1:8080",
+			"[2001:db8::1]:443",
+			"fe80::1%eth1",
+			"10.0.0.1",
+			"[fe80::1%eth0]:22",
+			"10.0.0.1:443",
+			"fe80::1",
+			"[2001:db8::1]",
+			"9.9.9.9:53",
+		},
+		[]string{
+			"9.9.9.9:53",
+			"10.0.0.1",
+			"10.0.0.1:443",
+			"10.0.0.1:8080",
+			"[2001:db8::1]",
+			"[2001:db8::1]:443",
+			"fe80::1",
+			"[fe80::1%eth0]:22",
+			"fe80::1%eth1",
+		},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	}
+	testOneCase(t, test, ipSort)
+
+	d := detest.New(t)
+	for _, test := range []struct {
+		line   string
+		ports  PortPolicy
+		expect string
+	}{
+		{"10.0.0.1:99999", PortsAllowed, "invalid port in '10.0.0.1:99999' at line 2"},
+		{"10.0.0.1:", PortsAllowed, "invalid port in '10.0.0.1:' at line 2"},
+		{"[10.0.0.1]:80", PortsAllowed, "invalid IP address '[10.0.0.1]:80' at line 2"},
+		{"10.0.0.1%eth0", PortsAllowed, "invalid IP address '10.0.0.1%eth0' at line 2"},
+		{"[::1", PortsAllowed, "invalid IP address '[::1' at line 2"},
+		{"10.0.0.1", PortsRequired, "the IP address '10.0.0.1' does not have a port at line 2"},
+		{"[::1]:80", PortsForbidden, "the IP address '[::1]:80' has a port at line 2"},
+	} {
+		params := SortParams{Ports: test.ports}
+		first := "1.1.1.1"
+		if test.ports == PortsRequired {
+			first = "1.1.1.1:80"
+		}
+		_, err := ipSort([]string{first, test.line}, params)
+		if d.Is(err != nil, true, "got an error for %q", test.line) {
+			d.Is(err.Error(), test.expect, "got expected error for %q", test.line)
+		}
+	}
+}
+
+func Test_ipSortWithFamilies(t *testing.T) {
+	input := []string{"2001:db8::1", "::ffff:10.0.0.1", "10.0.0.2", "::1", "10.0.0.1", "::ffff:9.0.0.1"}
+	for _, test := range []testCase{
+		{
+			name:   "mixed families",
+			input:  input,
+			expect: []string{"::1", "::ffff:9.0.0.1", "10.0.0.1", "::ffff:10.0.0.1", "10.0.0.2", "2001:db8::1"},
+			params: SortParams{},
+		},
+		{
+			name:   "IPv4 first",
+			input:  input,
+			expect: []string{"10.0.0.1", "10.0.0.2", "::1", "::ffff:9.0.0.1", "::ffff:10.0.0.1", "2001:db8::1"},
+			params: SortParams{IPFamilies: IPv4First},
+		},
+		{
+			name:   "IPv6 first",
+			input:  input,
+			expect: []string{"::1", "::ffff:9.0.0.1", "::ffff:10.0.0.1", "2001:db8::1", "10.0.0.1", "10.0.0.2"},
+			params: SortParams{IPFamilies: IPv6First},
+		},
+		{
+			name:   "IPv4 first with mapped addresses as IPv4",
+			input:  input,
+			expect: []string{"::ffff:9.0.0.1", "::ffff:10.0.0.1", "10.0.0.1", "10.0.0.2", "::1", "2001:db8::1"},
+			params: SortParams{IPFamilies: IPv4First, MappedAsIPv4: true},
+		},
+		{
+			name:   "IPv6 first with mapped addresses as IPv4",
+			input:  input,
+			expect: []string{"::1", "2001:db8::1", "::ffff:9.0.0.1", "::ffff:10.0.0.1", "10.0.0.1", "10.0.0.2"},
+			params: SortParams{IPFamilies: IPv6First, MappedAsIPv4: true},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, ipSort)
+		})
+	}
+}
+
+func TestUnmapIPv4(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		value  string
+		expect string
+		ok     bool
+	}{
+		{"::ffff:10.0.0.1", "10.0.0.1", true},
+		{"::FFFF:a00:1", "10.0.0.1", true},
+		{"[::ffff:10.0.0.1]:80", "10.0.0.1:80", true},
+		{"10.0.0.1", "", false},
+		{"2001:db8::1", "", false},
+		{"::ffff:10.0.0.1%eth0", "", false},
+		{"not an ip", "", false},
+	} {
+		got, ok := UnmapIPv4(test.value)
+		d.Is(ok, test.ok, "UnmapIPv4(%q) returns %v", test.value, test.ok)
+		d.Is(got, test.expect, "UnmapIPv4(%q)", test.value)
+	}
+}
+
 var networkSortTests = []testCase{
 	{
 		"network, just IPv4",
 		[]string{"1.1.1.1/32", "0.1.255.0/24", "123.100.125.0/25", "1.255.0.0/17", "1.255.0.0/16"},
 		[]string{"0.1.255.0/24", "1.1.1.1/32", "1.255.0.0/16", "1.255.0.0/17", "123.100.125.0/25"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -520,10 +640,10 @@ var networkSortTests = []testCase{
 		[]string{"1.1.1.1/32", "0.1.255.0/24", "123.100.125.0/25", "1.255.0.0/17", "1.255.0.0/16"},
 		[]string{"123.100.125.0/25", "1.255.0.0/17", "1.255.0.0/16", "1.1.1.1/32", "0.1.255.0/24"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -531,10 +651,10 @@ var networkSortTests = []testCase{
 		[]string{"::1/128", "::0/127", "::0/42", "9876::fe01:1234:0/24", "1234::/90"},
 		[]string{"::0/42", "::0/127", "::1/128", "1234::/90", "9876::fe01:1234:0/24"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -542,10 +662,10 @@ var networkSortTests = []testCase{
 		[]string{"::1/128", "::0/127", "::0/42", "9876::fe01:1234:0/24", "1234::/90"},
 		[]string{"9876::fe01:1234:0/24", "1234::/90", "::1/128", "::0/127", "::0/42"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -557,10 +677,10 @@ var networkSortTests = []testCase{
 			"1.2.3.0/16", "1.2.3.0/18", "255.255.255.0/25", "::0/42", "::0/127", "::1/128", "1234::/90", "9876::fe01:1234:0/24",
 		},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -572,10 +692,10 @@ var networkSortTests = []testCase{
 			"9876::fe01:1234:0/24", "1234::/90", "::1/128", "::0/127", "::0/42", "255.255.255.0/25", "1.2.3.0/18", "1.2.3.0/16",
 		},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 }
@@ -591,30 +711,28 @@ func Test_networkSort(t *testing.T) {
 	d := detest.New(t)
 
 	params := SortParams{
-		language.Und,
-		false,
-		false,
-		UnixPaths,
+		Locale:          language.Und,
+		CaseInsensitive: false,
+		Reverse:         false,
+		PathType:        UnixPaths,
 	}
 
 	{
 		lines := []string{"1.2.3.4/32", "not a network", "4.3.2.0/24"}
-		sorter, errRef := networkSort(&lines, params)
-		sort.Slice(lines, sorter)
+		_, err := networkSort(lines, params)
 		d.Is(
-			(*errRef).Error(),
-			"invalid CIDR address: not a network",
+			err.Error(),
+			"invalid CIDR address: not a network at line 2",
 			"got expected error when line contains a non-network",
 		)
 	}
 
 	{
 		lines := []string{"1.2.3.4/32", "1.1.1.1/-1", "4.3.2.0/24"}
-		sorter, errRef := networkSort(&lines, params)
-		sort.Slice(lines, sorter)
+		_, err := networkSort(lines, params)
 		d.Is(
-			(*errRef).Error(),
-			"invalid CIDR address: 1.1.1.1/-1",
+			err.Error(),
+			"invalid CIDR address: 1.1.1.1/-1 at line 2",
 			"got expected error when line contains a non-network",
 		)
 	}
@@ -626,10 +744,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 foo", "2018-12-30 bar", "2014-05-07 FUN"},
 		[]string{"2014-05-07 FUN", "2014-05-07 foo", "2017-1-12 hello", "2018-12-30 bar"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -637,10 +755,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 foo", "2018-12-30 bar", "2014-05-07 FUN"},
 		[]string{"2014-05-07 foo", "2014-05-07 FUN", "2017-1-12 hello", "2018-12-30 bar"},
 		SortParams{
-			language.Und,
-			true,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -648,10 +766,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 foo", "2018-12-30 bar", "2014-05-07 FUN"},
 		[]string{"2018-12-30 bar", "2017-1-12 hello", "2014-05-07 foo", "2014-05-07 FUN"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -659,10 +777,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 foo", "2018-12-30 bar", "2014-05-07 FUN"},
 		[]string{"2018-12-30 bar", "2017-1-12 hello", "2014-05-07 FUN", "2014-05-07 foo"},
 		SortParams{
-			language.Und,
-			true,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -670,10 +788,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 zoo", "2018-12-30 bar", "2014-05-07 öoo"},
 		[]string{"2014-05-07 öoo", "2014-05-07 zoo", "2017-1-12 hello", "2018-12-30 bar"},
 		SortParams{
-			language.German,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -681,10 +799,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 zoo", "2018-12-30 bar", "2014-05-07 öoo"},
 		[]string{"2018-12-30 bar", "2017-1-12 hello", "2014-05-07 zoo", "2014-05-07 öoo"},
 		SortParams{
-			language.German,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.German,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -692,10 +810,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 zoo", "2018-12-30 bar", "2014-05-07 öoo"},
 		[]string{"2014-05-07 zoo", "2014-05-07 öoo", "2017-1-12 hello", "2018-12-30 bar"},
 		SortParams{
-			language.Swedish,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Swedish,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -703,10 +821,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "2014-05-07 zoo", "2018-12-30 bar", "2014-05-07 öoo"},
 		[]string{"2018-12-30 bar", "2017-1-12 hello", "2014-05-07 öoo", "2014-05-07 zoo"},
 		SortParams{
-			language.Swedish,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Swedish,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -714,10 +832,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "no dt", "also none", "1973-01-01 and"},
 		[]string{"1973-01-01 and", "2017-1-12 hello", "also none", "no dt"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -725,10 +843,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12 hello", "no dt", "also none", "1973-01-01 and"},
 		[]string{"no dt", "also none", "2017-1-12 hello", "1973-01-01 and"},
 		SortParams{
-			language.Und,
-			false,
-			true,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
 		},
 	},
 	{
@@ -736,10 +854,10 @@ var datetimeTextSortTests = []testCase{
 		[]string{"2017-1-12T01:00:37", "1001-01-02", "2017-1-12T14:01:01"},
 		[]string{"1001-01-02", "2017-1-12T01:00:37", "2017-1-12T14:01:01"},
 		SortParams{
-			language.Und,
-			false,
-			false,
-			UnixPaths,
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
 		},
 	},
 }
@@ -753,18 +871,721 @@ func Test_datetimeTextSort(t *testing.T) {
 	}
 }
 
-func testOneCase(t *testing.T, test testCase, sortMaker func(*[]string, SortParams) (sortFunc, *error)) {
+func Test_datetimeTextSortWithDateOrder(t *testing.T) {
+	tests := []testCase{
+		{
+			name:   "unambiguous dates are read either way",
+			input:  []string{"13/02/2020 b", "02/14/2020 c", "2020-02-12 a"},
+			expect: []string{"2020-02-12 a", "13/02/2020 b", "02/14/2020 c"},
+			params: SortParams{},
+		},
+		{
+			name:   "day first",
+			input:  []string{"01/02/2020 b", "02/01/2020 a", "13.02.2020 c"},
+			expect: []string{"02/01/2020 a", "01/02/2020 b", "13.02.2020 c"},
+			params: SortParams{DateOrder: DayFirst},
+		},
+		{
+			name:   "month first",
+			input:  []string{"02/01/2020 c", "01/02/2020 a", "01-03-2020 b"},
+			expect: []string{"01/02/2020 a", "01-03-2020 b", "02/01/2020 c"},
+			params: SortParams{DateOrder: MonthFirst},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, datetimeTextSort)
+		})
+	}
+
+	d := detest.New(t)
+	for _, test := range []struct {
+		line   string
+		params SortParams
+		expect string
+	}{
+		{
+			"01/02/2020 b",
+			SortParams{},
+			"the date in '01/02/2020' is ambiguous because the month could come before or after the day at line 2",
+		},
+		{
+			"01.02.2020 b",
+			SortParams{},
+			"the date in '01.02.2020' is ambiguous because the month could come before or after the day at line 2",
+		},
+		{
+			"13/02/2020 b",
+			SortParams{DateOrder: MonthFirst},
+			`parsing time "13/02/2020": month out of range at line 2`,
+		},
+	} {
+		_, err := datetimeTextSort([]string{"2020-01-01 a", test.line}, test.params)
+		if d.Is(err != nil, true, "got an error for %q", test.line) {
+			d.Is(err.Error(), test.expect, "got expected error for %q", test.line)
+		}
+	}
+}
+
+func Test_datetimeTextSortWithLayouts(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("could not load Europe/Berlin: %s", err)
+	}
+
+	tests := []testCase{
+		{
+			name:   "layouts are tried in order",
+			input:  []string{"02/01/2020 10:00 c", "no date", "2020-01-01T12:00:00Z b", "01/01/2020 09:00 a"},
+			expect: []string{"01/01/2020 09:00 a", "2020-01-01T12:00:00Z b", "02/01/2020 10:00 c", "no date"},
+			params: SortParams{
+				DatetimeLayouts: []string{"02/01/2006 15:04", time.RFC3339},
+				Location:        time.UTC,
+			},
+		},
+		{
+			name:   "datetimes without a zone use the location",
+			input:  []string{"2020-01-01T11:30:00Z b", "2020-01-01 12:00 a"},
+			expect: []string{"2020-01-01 12:00 a", "2020-01-01T11:30:00Z b"},
+			params: SortParams{
+				DatetimeLayouts: []string{"2006-01-02 15:04", time.RFC3339},
+				Location:        berlin,
+			},
+		},
+		{
+			name:   "guessed datetimes without a zone use the location",
+			input:  []string{"2020-01-01T11:30:00Z b", "2020-01-01T12:00:00 a"},
+			expect: []string{"2020-01-01T12:00:00 a", "2020-01-01T11:30:00Z b"},
+			params: SortParams{Location: berlin},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, datetimeTextSort)
+		})
+	}
+
+	_, err = datetimeTextSort(
+		[]string{"01/01/2020 09:00 a", "2020-01-01 b"},
+		SortParams{DatetimeLayouts: []string{"02/01/2006 15:04"}},
+	)
+	d := detest.New(t)
+	if d.Is(err != nil, true, "got an error for a line which does not match a layout") {
+		d.Is(
+			err.Error(),
+			"the line '2020-01-01 b' does not start with a datetime in any of the given formats at line 2",
+			"got expected error for a line which does not match a layout",
+		)
+	}
+}
+
+func TestDatetimeLayout(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		format string
+		expect string
+	}{
+		{"%d/%m/%Y %H:%M:%S", "02/01/2006 15:04:05"},
+		{"%F %T.%f %z", "2006-01-02 15:04:05.000000 -0700"},
+		{"%b %e %I:%M %p", "Jan _2 03:04 PM"},
+		{"100%% %Y", "100% 2006"},
+		{"02.01.2006", "02.01.2006"},
+	} {
+		layout, err := DatetimeLayout(test.format)
+		d.Is(err, nil, "no error converting %q", test.format)
+		d.Is(layout, test.expect, "layout for %q", test.format)
+	}
+
+	for _, test := range []struct {
+		format string
+		expect string
+	}{
+		{"", "a datetime format cannot be empty"},
+		{"%Y-%m-%Q", `the datetime format "%Y-%m-%Q" contains an unsupported directive, %Q`},
+		{"%Y-%m-%", `the datetime format "%Y-%m-%" ends with a %`},
+		{"%S%f", `the %f directive in the datetime format "%S%f" must come after a "." or ","`},
+	} {
+		_, err := DatetimeLayout(test.format)
+		if d.Is(err != nil, true, "got an error for %q", test.format) {
+			d.Is(err.Error(), test.expect, "got expected error for %q", test.format)
+		}
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		name   string
+		offset int
+	}{
+		{"UTC", 0},
+		{"+02:00", 2 * 60 * 60},
+		{"-0530", -(5*60*60 + 30*60)},
+		{"+14:00", 14 * 60 * 60},
+		{"-14:00", -14 * 60 * 60},
+	} {
+		loc, err := ParseTimezone(test.name)
+		if d.Is(err, nil, "no error parsing %q", test.name) {
+			_, offset := time.Date(2020, 1, 1, 0, 0, 0, 0, loc).Zone()
+			d.Is(offset, test.offset, "offset for %q", test.name)
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		expect string
+	}{
+		{"+99:99", "the time zone offset +99:99 is not between -14:00 and +14:00"},
+		{"-14:30", "the time zone offset -14:30 is not between -14:00 and +14:00"},
+		{"+02:60", "the time zone offset +02:60 is not between -14:00 and +14:00"},
+		{"Nowhere/Special", "could not find a time zone matching Nowhere/Special: unknown time zone Nowhere/Special"},
+	} {
+		_, err := ParseTimezone(test.name)
+		if d.Is(err != nil, true, "got an error for %q", test.name) {
+			d.Is(err.Error(), test.expect, "got expected error for %q", test.name)
+		}
+	}
+}
+
+var hostnameSortTests = []testCase{
+	{
+		"hostnames",
+		[]string{"b.example.com", "a.example.org", "example.com", "*.example.com", "a.example.com", "com"},
+		[]string{"com", "example.com", "*.example.com", "a.example.com", "b.example.com", "a.example.org"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"hostnames, reversed",
+		[]string{"b.example.com", "a.example.org", "example.com", "*.example.com", "a.example.com", "com"},
+		[]string{"a.example.org", "b.example.com", "a.example.com", "*.example.com", "example.com", "com"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"hostnames with mixed case and punycode",
+		[]string{"Zoo.de", "xn--bcher-kva.de", "BAR.de", "bücher.de", "a.bücher.de"},
+		[]string{"BAR.de", "xn--bcher-kva.de", "bücher.de", "a.bücher.de", "Zoo.de"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+}
+
+func Test_hostnameSort(t *testing.T) {
+	for _, test := range hostnameSortTests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, hostnameSort)
+		})
+	}
+
+	params := SortParams{
+		Locale:          language.Und,
+		CaseInsensitive: false,
+		Reverse:         false,
+		PathType:        UnixPaths,
+	}
+	lines := []string{"example.com", "foo..example.com"}
+	_, err := hostnameSort(lines, params)
+	d := detest.New(t)
+	d.Is(
+		err.Error(),
+		"invalid hostname 'foo..example.com': the name contains an empty label at line 2",
+		"got expected error when line contains an invalid hostname",
+	)
+}
+
+var emailSortTests = []testCase{
+	{
+		"email addresses",
+		[]string{"zed@example.org", "bob@b.example.com", "carol@example.com", "alice@example.com", "dave@Example.COM"},
+		[]string{"alice@example.com", "carol@example.com", "dave@Example.COM", "bob@b.example.com", "zed@example.org"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"email addresses, reversed",
+		[]string{"zed@example.org", "bob@b.example.com", "carol@example.com", "alice@example.com"},
+		[]string{"zed@example.org", "bob@b.example.com", "carol@example.com", "alice@example.com"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"email addresses with names",
+		[]string{
+			"Zed <zed@example.com>",
+			"Alice Smith <alice@example.org> <asmith@old.example.org>",
+			"<bob@example.com>",
+			"Carol <Carol@example.com>",
+		},
+		[]string{
+			"Carol <Carol@example.com>",
+			"<bob@example.com>",
+			"Zed <zed@example.com>",
+			"Alice Smith <alice@example.org> <asmith@old.example.org>",
+		},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"email addresses with names, case-insensitive",
+		[]string{
+			"Zed <zed@example.com>",
+			"<bob@example.com>",
+			"Carol <Carol@example.com>",
+		},
+		[]string{
+			"<bob@example.com>",
+			"Carol <Carol@example.com>",
+			"Zed <zed@example.com>",
+		},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: true,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+}
+
+func Test_emailSort(t *testing.T) {
+	for _, test := range emailSortTests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, emailSort)
+		})
+	}
+
+	params := SortParams{
+		Locale:          language.Und,
+		CaseInsensitive: false,
+		Reverse:         false,
+		PathType:        UnixPaths,
+	}
+	d := detest.New(t)
+	for _, test := range []struct {
+		line   string
+		expect string
+	}{
+		{"Foo <foo@example.com", "invalid email address 'Foo <foo@example.com': missing closing '>' at line 2"},
+		{"foo@-bar.com", `invalid email address 'foo@-bar.com': invalid domain: the label "-bar" starts or ends with a hyphen at line 2`},
+	} {
+		_, err := emailSort([]string{"foo@example.com", test.line}, params)
+		d.Is(err.Error(), test.expect, "got expected error for %q", test.line)
+	}
+}
+
+var urlSortTests = []testCase{
+	{
+		"URLs",
+		[]string{
+			"https://www.example.com/b",
+			"https://example.com:8443/",
+			"http://example.org/",
+			"https://example.com/a/b/c",
+			"https://api.example.com/",
+			"https://10.0.0.1/",
+			"file:///etc/hosts",
+			"https://example.com/z",
+			"https://example.com/a?b=2&a=1",
+			"https://example.com/a?a=1",
+			"HTTPS://Example.COM/",
+		},
+		[]string{
+			"file:///etc/hosts",
+			"http://example.org/",
+			"https://10.0.0.1/",
+			"HTTPS://Example.COM/",
+			"https://example.com/a?a=1",
+			"https://example.com/a?b=2&a=1",
+			"https://example.com/z",
+			"https://example.com/a/b/c",
+			"https://example.com:8443/",
+			"https://api.example.com/",
+			"https://www.example.com/b",
+		},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"URLs, reversed",
+		[]string{"https://example.com/a", "http://example.com/", "https://example.com/"},
+		[]string{"https://example.com/a", "https://example.com/", "http://example.com/"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"URLs, normalized",
+		[]string{
+			"https://example.com:443/b",
+			"https://example.com/a/./c/../b",
+			"https://example.com",
+			"https://example.com/%61",
+			"https://example.com:8443/",
+		},
+		[]string{
+			"https://example.com",
+			"https://example.com/%61",
+			"https://example.com:443/b",
+			"https://example.com/a/./c/../b",
+			"https://example.com:8443/",
+		},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+			NormalizeURLs:   true,
+		},
+	},
+	{
+		"URLs with IPv4 and IPv6 hosts",
+		[]string{
+			"https://[2001:db8::1]/",
+			"https://10.0.0.2/",
+			"https://[::1]/",
+			"https://[::ffff:10.0.0.1]/",
+			"https://1.1.1.1/",
+			"https://example.com/",
+		},
+		[]string{
+			"https://1.1.1.1/",
+			"https://10.0.0.2/",
+			"https://[::1]/",
+			"https://[::ffff:10.0.0.1]/",
+			"https://[2001:db8::1]/",
+			"https://example.com/",
+		},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+}
+
+func Test_urlSort(t *testing.T) {
+	for _, test := range urlSortTests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, urlSort)
+		})
+	}
+
+	params := SortParams{
+		Locale:          language.Und,
+		CaseInsensitive: false,
+		Reverse:         false,
+		PathType:        UnixPaths,
+	}
+	d := detest.New(t)
+	for _, test := range []struct {
+		line   string
+		expect string
+	}{
+		{"example.com/foo", "invalid URL 'example.com/foo': missing scheme at line 2"},
+		{"https://foo..com/", "invalid URL 'https://foo..com/': invalid host: the name contains an empty label at line 2"},
+	} {
+		_, err := urlSort([]string{"https://example.com/", test.line}, params)
+		d.Is(err.Error(), test.expect, "got expected error for %q", test.line)
+	}
+}
+
+var ipOrNetworkSortTests = []testCase{
+	{
+		"IP addresses and networks",
+		[]string{"10.0.0.1", "::1", "10.0.0.0/24", "9.255.255.255", "10.0.0.1/32", "10.0.0.0/8", "2001:db8::/32"},
+		[]string{"9.255.255.255", "10.0.0.0/8", "10.0.0.0/24", "10.0.0.1", "10.0.0.1/32", "::1", "2001:db8::/32"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         false,
+			PathType:        UnixPaths,
+		},
+	},
+	{
+		"IP addresses and networks, reversed",
+		[]string{"10.0.0.1", "::1", "10.0.0.0/24", "10.0.0.0/8"},
+		[]string{"::1", "10.0.0.1", "10.0.0.0/24", "10.0.0.0/8"},
+		SortParams{
+			Locale:          language.Und,
+			CaseInsensitive: false,
+			Reverse:         true,
+			PathType:        UnixPaths,
+		},
+	},
+}
+
+func Test_ipOrNetworkSort(t *testing.T) {
+	for _, test := range ipOrNetworkSortTests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, ipOrNetworkSort)
+		})
+	}
+
+	params := SortParams{
+		Locale:          language.Und,
+		CaseInsensitive: false,
+		Reverse:         false,
+		PathType:        UnixPaths,
+	}
+	_, err := ipOrNetworkSort([]string{"10.0.0.1", "10.0.0.0/33"}, params)
 	d := detest.New(t)
-	// If the test fails and we haven't cloned then we cannot print
-	// out debugging info with the original and the (improperly
-	// sorted) list.
-	clone := make([]string, len(test.input))
-	copy(clone, test.input)
-	sorter, errRef := sortMaker(&clone, test.params)
-	sort.Slice(clone, sorter)
-	d.Is(*errRef, nil, "no error from calling sorting func")
 	d.Is(
-		clone,
+		err.Error(),
+		"invalid IP address or network '10.0.0.0/33' at line 2",
+		"got expected error when line contains an invalid network",
+	)
+}
+
+func Test_canonicalIPOrNetwork(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		value  string
+		expect string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"10.0.0.1/32", "10.0.0.1/32"},
+		{"10.0.0.5/24", "10.0.0.0/24"},
+		{"2001:DB8:0:0::1", "2001:db8::1"},
+		{"2001:db8:0:0:1::/80", "2001:db8:0:0:1::/80"},
+	} {
+		got, err := canonicalIPOrNetwork(test.value)
+		d.Is(err, nil, "no error canonicalizing %q", test.value)
+		d.Is(got, test.expect, "canonical form of %q", test.value)
+	}
+}
+
+func Test_macSort(t *testing.T) {
+	test := testCase{
+		name: "MAC addresses in mixed forms",
+		input: []string{
+			"00-11-22-33-44-56",
+			"0011.2233.4455",
+			"00:11:22:33:44:55:66:77",
+			"AA:BB:CC:DD:EE:FF",
+			"0a1b2c3d4e5f",
+			"00:00:00:00:00:01",
+		},
+		expect: []string{
+			"00:00:00:00:00:01",
+			"0011.2233.4455",
+			"00-11-22-33-44-56",
+			"0a1b2c3d4e5f",
+			"AA:BB:CC:DD:EE:FF",
+			"00:11:22:33:44:55:66:77",
+		},
+		params: SortParams{},
+	}
+	testOneCase(t, test, macSort)
+
+	d := detest.New(t)
+	for _, test := range []struct {
+		line   string
+		expect string
+	}{
+		{"00:11:22:33:44", "invalid MAC address '00:11:22:33:44' at line 2"},
+		{"0011223344gg", "invalid MAC address '0011223344gg' at line 2"},
+		{"00:11:22:33:44:55:66", "invalid MAC address '00:11:22:33:44:55:66' at line 2"},
+		{"not a mac", "invalid MAC address 'not a mac' at line 2"},
+	} {
+		_, err := macSort([]string{"00:11:22:33:44:55", test.line}, SortParams{})
+		if d.Is(err != nil, true, "got an error for %q", test.line) {
+			d.Is(err.Error(), test.expect, "got expected error for %q", test.line)
+		}
+	}
+}
+
+func Test_uuidSort(t *testing.T) {
+	// The v1 and v6 UUIDs are for the same time, and the v7 UUID is for one
+	// millisecond later. The v4 UUIDs don't have a timestamp.
+	input := []string{
+		"{919108F7-52D1-4320-9BAC-F847DB4148A8}",
+		"017F22E2-79B1-7CC3-98C4-DC0C0C07398F",
+		"c232ab00941411ecb3c89f6bdeced846",
+		"1EC9414C-232A-6B00-B3C8-9F6BDECED846",
+		"0a5f1bd4-1d0e-4b34-9d7c-6f5c1f1bd9c0",
+	}
+	tests := []testCase{
+		{
+			name:  "UUIDs by value",
+			input: input,
+			expect: []string{
+				"017F22E2-79B1-7CC3-98C4-DC0C0C07398F",
+				"0a5f1bd4-1d0e-4b34-9d7c-6f5c1f1bd9c0",
+				"1EC9414C-232A-6B00-B3C8-9F6BDECED846",
+				"{919108F7-52D1-4320-9BAC-F847DB4148A8}",
+				"c232ab00941411ecb3c89f6bdeced846",
+			},
+			params: SortParams{},
+		},
+		{
+			name:  "UUIDs by time",
+			input: input,
+			expect: []string{
+				"1EC9414C-232A-6B00-B3C8-9F6BDECED846",
+				"c232ab00941411ecb3c89f6bdeced846",
+				"017F22E2-79B1-7CC3-98C4-DC0C0C07398F",
+				"0a5f1bd4-1d0e-4b34-9d7c-6f5c1f1bd9c0",
+				"{919108F7-52D1-4320-9BAC-F847DB4148A8}",
+			},
+			params: SortParams{UUIDTimeOrder: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//nolint:scopelint
+			testOneCase(t, test, uuidSort)
+		})
+	}
+
+	_, err := uuidSort([]string{"919108f7-52d1-4320-9bac-f847db4148a8", "not-a-uuid"}, SortParams{})
+	d := detest.New(t)
+	if d.Is(err != nil, true, "got an error for an invalid UUID") {
+		d.Is(
+			err.Error(),
+			"invalid UUID 'not-a-uuid': a UUID must have 32 hex digits at line 2",
+			"got expected error when line contains an invalid UUID",
+		)
+	}
+}
+
+func Test_ulidSort(t *testing.T) {
+	test := testCase{
+		name: "ULIDs",
+		input: []string{
+			"01ARZ3NDEKTSV4RRFFQ69G5FAW",
+			"01BX5ZZKBKACTAV9WEVGEMMVRZ",
+			"01arz3ndektsv4rrffq69g5fav",
+			"01ARZ3NDEK0000000000000000",
+		},
+		expect: []string{
+			"01ARZ3NDEK0000000000000000",
+			"01arz3ndektsv4rrffq69g5fav",
+			"01ARZ3NDEKTSV4RRFFQ69G5FAW",
+			"01BX5ZZKBKACTAV9WEVGEMMVRZ",
+		},
+		params: SortParams{},
+	}
+	testOneCase(t, test, ulidSort)
+
+	_, err := ulidSort([]string{"01ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAU"}, SortParams{})
+	d := detest.New(t)
+	if d.Is(err != nil, true, "got an error for an invalid ULID") {
+		d.Is(
+			err.Error(),
+			"invalid ULID '01ARZ3NDEKTSV4RRFFQ69G5FAU': 'U' is not a valid ULID character at line 2",
+			"got expected error when line contains an invalid ULID",
+		)
+	}
+}
+
+func Test_canonicalMAC(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		value  string
+		expect string
+	}{
+		{"00:11:22:33:44:55", "00:11:22:33:44:55"},
+		{"AA-BB-CC-DD-EE-FF", "aa:bb:cc:dd:ee:ff"},
+		{"0011.2233.4455", "00:11:22:33:44:55"},
+		{"001122334455", "00:11:22:33:44:55"},
+		{"0011223344556677", "00:11:22:33:44:55:66:77"},
+	} {
+		got, err := canonicalMAC(test.value)
+		d.Is(err, nil, "no error canonicalizing %q", test.value)
+		d.Is(got, test.expect, "canonical form of %q", test.value)
+	}
+}
+
+func Test_canonicalIP(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		value  string
+		expect string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"10.0.0.1:80", "10.0.0.1:80"},
+		{"2001:DB8:0:0::1", "2001:db8::1"},
+		{"2001:db8:0:0:1:0:0:1", "2001:db8::1:0:0:1"},
+		{"[2001:DB8::0:1]:443", "[2001:db8::1]:443"},
+		{"FE80::1%eth0", "fe80::1%eth0"},
+		{"::FFFF:10.0.0.1", "::ffff:10.0.0.1"},
+		{"[::ffff:10.0.0.1]:80", "[::ffff:10.0.0.1]:80"},
+	} {
+		got, err := canonicalIP(test.value)
+		d.Is(err, nil, "no error canonicalizing %q", test.value)
+		d.Is(got, test.expect, "canonical form of %q", test.value)
+	}
+}
+
+func Test_canonicalNetwork(t *testing.T) {
+	d := detest.New(t)
+	for _, test := range []struct {
+		value  string
+		expect string
+	}{
+		{"10.0.0.0/24", "10.0.0.0/24"},
+		{"10.0.0.5/24", "10.0.0.0/24"},
+		{"2001:DB8:0:0::/32", "2001:db8::/32"},
+		{"2001:db8::1/32", "2001:db8::/32"},
+		{"10.0.0.5 255.255.255.0", "10.0.0.0 255.255.255.0"},
+		{"10.0.0.5 0.0.0.255", "10.0.0.0 0.0.0.255"},
+		{"10.0.0.1 - 10.0.0.9", "10.0.0.1-10.0.0.9"},
+		{"2001:DB8::1-2001:DB8::9", "2001:db8::1-2001:db8::9"},
+	} {
+		got, err := canonicalNetwork(test.value)
+		d.Is(err, nil, "no error canonicalizing %q", test.value)
+		d.Is(got, test.expect, "canonical form of %q", test.value)
+	}
+}
+
+func testOneCase(t *testing.T, test testCase, maker compareFuncMaker) {
+	d := detest.New(t)
+	sorter := NewSorter(Key{
+		Approach: Approach{MakeCompareFunc: maker},
+		Params:   test.params,
+	})
+	sorted, err := sorter.Sort(test.input)
+	d.Is(err, nil, "no error from sorting")
+	d.Is(
+		sorted,
 		d.Slice(func(st *detest.SliceTester) {
 			st.End()
 			for i, e := range test.expect {
@@ -774,3 +1595,185 @@ func testOneCase(t *testing.T, test testCase, sortMaker func(*[]string, SortPara
 		"check sorted output",
 	)
 }
+
+func approach(name string) Approach {
+	a, ok := ApproachByName(name)
+	if !ok {
+		panic("no such approach " + name)
+	}
+	return a
+}
+
+func TestSorterWithMultipleKeys(t *testing.T) {
+	d := detest.New(t)
+
+	lines := []string{
+		"10.0.0.0/24 foo 2020-01-02",
+		"10.0.0.0/24 bar 2020-01-02",
+		"1.1.1.0/24 zed 2019-01-01",
+		"10.0.0.0/24 baz 2021-05-07",
+		"10.0.0.0/24 Öde 2020-01-02",
+	}
+
+	sorter := NewSorter(
+		Key{
+			Field:    1,
+			Approach: approach("network"),
+		},
+		Key{
+			Field:    3,
+			Approach: approach("datetime-text"),
+			Params:   SortParams{Reverse: true},
+		},
+		Key{
+			Field:    2,
+			Approach: approach("text"),
+			Params:   SortParams{Locale: language.German},
+		},
+	)
+	sorted, err := sorter.Sort(lines)
+	d.Require(d.Is(err, nil, "no error from sorting"))
+	d.Is(
+		sorted,
+		[]string{
+			"1.1.1.0/24 zed 2019-01-01",
+			"10.0.0.0/24 baz 2021-05-07",
+			"10.0.0.0/24 bar 2020-01-02",
+			"10.0.0.0/24 foo 2020-01-02",
+			"10.0.0.0/24 Öde 2020-01-02",
+		},
+		"lines are sorted by network, then by reversed date, then by German text",
+	)
+
+	keys, err := sorter.Keys(sorted)
+	d.Require(d.Is(err, nil, "no error from parsing keys"))
+	d.Is(keys.IsSorted(), true, "sorted lines are sorted")
+
+	keys, err = sorter.Keys(lines)
+	d.Require(d.Is(err, nil, "no error from parsing keys"))
+	d.Is(keys.IsSorted(), false, "original lines are not sorted")
+}
+
+func TestSorterWithMissingField(t *testing.T) {
+	d := detest.New(t)
+
+	sorter := NewSorter(
+		Key{
+			Field:    2,
+			Approach: approach("numbered-text"),
+		},
+		Key{
+			Approach: approach("text"),
+		},
+	)
+	sorted, err := sorter.Sort([]string{"c 2", "b", "a 10", "a"})
+	d.Require(d.Is(err, nil, "no error from sorting"))
+	d.Is(
+		sorted,
+		[]string{"c 2", "a 10", "a", "b"},
+		"lines with a missing field sort after lines with a number in that field",
+	)
+}
+
+func TestParseErrorForField(t *testing.T) {
+	d := detest.New(t)
+
+	sorter := NewSorter(Key{
+		Field:    2,
+		Approach: approach("ip"),
+	})
+	_, err := sorter.Sort([]string{"a 1.2.3.4", "b 1.2.3", "c 4.3.2.1"})
+	d.Is(
+		err.Error(),
+		"invalid IP address '1.2.3' at line 2",
+		"got expected error when a field contains a non-ip",
+	)
+}
+
+func TestSorterWithKeyRegex(t *testing.T) {
+	lines := []string{
+		"level=info from=10.0.0.2 msg=a",
+		"level=info msg=no-source",
+		"level=warn from=10.0.0.10 msg=b",
+		"level=info from=9.1.1.1 msg=c",
+	}
+
+	tests := []struct {
+		name      string
+		expr      string
+		unmatched UnmatchedPolicy
+		reverse   bool
+		expect    []string
+	}{
+		{
+			name:      "unmatched first",
+			expr:      `from=(\S+)`,
+			unmatched: UnmatchedFirst,
+			expect: []string{
+				"level=info msg=no-source",
+				"level=info from=9.1.1.1 msg=c",
+				"level=info from=10.0.0.2 msg=a",
+				"level=warn from=10.0.0.10 msg=b",
+			},
+		},
+		{
+			name:      "unmatched last with named group",
+			expr:      `level=(\w+) from=(?P<key>\S+)`,
+			unmatched: UnmatchedLast,
+			expect: []string{
+				"level=info from=9.1.1.1 msg=c",
+				"level=info from=10.0.0.2 msg=a",
+				"level=warn from=10.0.0.10 msg=b",
+				"level=info msg=no-source",
+			},
+		},
+		{
+			name:      "unmatched last, reversed",
+			expr:      `from=(\S+)`,
+			unmatched: UnmatchedLast,
+			reverse:   true,
+			expect: []string{
+				"level=warn from=10.0.0.10 msg=b",
+				"level=info from=10.0.0.2 msg=a",
+				"level=info from=9.1.1.1 msg=c",
+				"level=info msg=no-source",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			d := detest.New(t)
+			kr, err := NewKeyRegex(test.expr)
+			d.Require(d.Is(err, nil, "no error from NewKeyRegex"))
+
+			sorter := NewSorter(Key{
+				Extractor: kr,
+				Unmatched: test.unmatched,
+				Approach:  approach("ip"),
+				Params:    SortParams{Reverse: test.reverse},
+			})
+			sorted, err := sorter.Sort(lines)
+			d.Require(d.Is(err, nil, "no error from sorting"))
+			d.Is(sorted, test.expect, "lines are sorted by the IP in the regex key")
+		})
+	}
+
+	d := detest.New(t)
+	kr, err := NewKeyRegex(`from=(\S+)`)
+	d.Require(d.Is(err, nil, "no error from NewKeyRegex"))
+	_, err = NewSorter(Key{Extractor: kr, Approach: approach("ip")}).Sort(lines)
+	d.Is(
+		err.Error(),
+		`'level=info msg=no-source' does not match the key regex from=(\S+) at line 2`,
+		"got expected error when a line does not match the key regex",
+	)
+
+	_, err = NewSorter(Key{Extractor: kr, Approach: approach("ip")}).Sort([]string{"from=1.1.1.1", "from=1.1.1"})
+	d.Is(
+		err.Error(),
+		"invalid IP address '1.1.1' at line 2",
+		"got expected error when the regex key is not an ip",
+	)
+}
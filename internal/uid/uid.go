@@ -0,0 +1,173 @@
+// Package uid parses UUIDs and ULIDs into their 128-bit values. Both are
+// case-insensitive, and a UUID can be written with or without hyphens and
+// braces, so identifiers which are written differently but have the same
+// value are equal once they're parsed.
+package uid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UUID is the 128-bit value of a UUID.
+type UUID [16]byte
+
+// gregorianOffset is the number of 100 nanosecond intervals between the
+// start of the Gregorian calendar, which is the epoch for v1 and v6 UUIDs,
+// and the Unix epoch, which is the epoch for v7 UUIDs.
+const gregorianOffset = 0x01B21DD213814000
+
+// ParseUUID parses a UUID like "f81d4fae-7dec-11d0-a765-00a0c91e6bf6". The
+// hyphens are optional, and the UUID can be wrapped in braces, as in
+// "{f81d4fae-7dec-11d0-a765-00a0c91e6bf6}".
+func ParseUUID(s string) (UUID, error) {
+	hexDigits := s
+	if strings.HasPrefix(hexDigits, "{") || strings.HasSuffix(hexDigits, "}") {
+		if !strings.HasPrefix(hexDigits, "{") || !strings.HasSuffix(hexDigits, "}") {
+			return UUID{}, errors.New("the braces are not balanced")
+		}
+		hexDigits = hexDigits[1 : len(hexDigits)-1]
+	}
+
+	if len(hexDigits) == 36 {
+		for _, i := range []int{8, 13, 18, 23} {
+			if hexDigits[i] != '-' {
+				return UUID{}, errors.New("the hyphens are not in the right places")
+			}
+		}
+		hexDigits = strings.ReplaceAll(hexDigits, "-", "")
+	}
+	if len(hexDigits) != 32 {
+		return UUID{}, errors.New("a UUID must have 32 hex digits")
+	}
+
+	var u UUID
+	if _, err := hex.Decode(u[:], []byte(hexDigits)); err != nil {
+		return UUID{}, errors.New("a UUID can only contain hex digits")
+	}
+	return u, nil
+}
+
+// Version returns the version of the UUID, from the high 4 bits of the
+// 7th byte.
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time returns the timestamp embedded in a v1, v6, or v7 UUID as the number
+// of 100 nanosecond intervals since the start of the Gregorian calendar. The
+// timestamps in v7 UUIDs only have millisecond precision. It returns false
+// for other UUIDs, which don't have a timestamp.
+func (u UUID) Time() (int64, bool) {
+	// Only UUIDs with the variant from RFC 4122 have a version.
+	if u[8]&0xc0 != 0x80 {
+		return 0, false
+	}
+
+	switch u.Version() {
+	case 1:
+		low := int64(u[0])<<24 | int64(u[1])<<16 | int64(u[2])<<8 | int64(u[3])
+		mid := int64(u[4])<<8 | int64(u[5])
+		high := int64(u[6]&0x0f)<<8 | int64(u[7])
+		return high<<48 | mid<<32 | low, true
+	case 6:
+		high := int64(u[0])<<24 | int64(u[1])<<16 | int64(u[2])<<8 | int64(u[3])
+		mid := int64(u[4])<<8 | int64(u[5])
+		low := int64(u[6]&0x0f)<<8 | int64(u[7])
+		return high<<28 | mid<<12 | low, true
+	case 7:
+		var ms int64
+		for _, b := range u[:6] {
+			ms = ms<<8 | int64(b)
+		}
+		return ms*10000 + gregorianOffset, true
+	}
+
+	return 0, false
+}
+
+// String returns the UUID as lowercase hex with hyphens, like
+// "f81d4fae-7dec-11d0-a765-00a0c91e6bf6".
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:])
+}
+
+// Compare compares two UUIDs by their 128-bit values.
+func (u UUID) Compare(other UUID) int {
+	return bytes.Compare(u[:], other[:])
+}
+
+// ULID is the 128-bit value of a ULID. The first 48 bits are a timestamp and
+// the rest are random, so comparing the values orders ULIDs by timestamp
+// and then by their random part.
+type ULID [16]byte
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ParseULID parses a ULID like "01ARZ3NDEKTSV4RRFFQ69G5FAV". ULIDs are
+// case-insensitive.
+func ParseULID(s string) (ULID, error) {
+	if len(s) != 26 {
+		return ULID{}, errors.New("a ULID must have 26 characters")
+	}
+
+	// Each character is 5 bits, so 26 characters are 130 bits. The first
+	// character can only be 0-7, since the top 2 bits would overflow.
+	var u ULID
+	for i, r := range strings.ToUpper(s) {
+		n := strings.IndexRune(crockford, r)
+		if n < 0 {
+			return ULID{}, fmt.Errorf("%q is not a valid ULID character", r)
+		}
+		if i == 0 && n > 7 {
+			return ULID{}, errors.New("the ULID is too large")
+		}
+		shiftLeft(&u, 5)
+		u[15] |= byte(n)
+	}
+
+	return u, nil
+}
+
+// shiftLeft shifts all the bits in u left by n bits, where n is less than
+// 8.
+func shiftLeft(u *ULID, n uint) {
+	for i := 0; i < len(u)-1; i++ {
+		u[i] = u[i]<<n | u[i+1]>>(8-n)
+	}
+	u[len(u)-1] <<= n
+}
+
+// String returns the ULID in uppercase, like "01ARZ3NDEKTSV4RRFFQ69G5FAV".
+func (u ULID) String() string {
+	var b strings.Builder
+	// The value is 128 bits, so the first character only has 3 bits.
+	for start := 125; start >= 0; start -= 5 {
+		b.WriteByte(crockford[u.bits(start)])
+	}
+	return b.String()
+}
+
+// bits returns the 5 bits of u starting at the given bit, counting from the
+// lowest bit. Bits past the top of the value are 0.
+func (u ULID) bits(start int) int {
+	n := 0
+	for bit := start + 4; bit >= start; bit-- {
+		n <<= 1
+		if bit > 127 {
+			continue
+		}
+		n |= int(u[15-bit/8]>>(uint(bit)%8)) & 1
+	}
+	return n
+}
+
+// Compare compares two ULIDs by their 128-bit values.
+func (u ULID) Compare(other ULID) int {
+	return bytes.Compare(u[:], other[:])
+}
@@ -0,0 +1,107 @@
+package uid
+
+import (
+	"testing"
+
+	"github.com/houseabsolute/detest/pkg/detest"
+)
+
+func TestParseUUID(t *testing.T) {
+	tests := []string{
+		"f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+		"F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6",
+		"f81d4fae7dec11d0a76500a0c91e6bf6",
+		"{f81d4fae-7dec-11d0-a765-00a0c91e6bf6}",
+		"{F81D4FAE7DEC11D0A76500A0C91E6BF6}",
+	}
+
+	d := detest.New(t)
+	for _, s := range tests {
+		u, err := ParseUUID(s)
+		d.Is(err, nil, "no error parsing %q", s)
+		d.Is(u.String(), "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "canonical form of %q", s)
+	}
+}
+
+func TestParseUUIDErrors(t *testing.T) {
+	tests := []struct {
+		s      string
+		expect string
+	}{
+		{"", "a UUID must have 32 hex digits"},
+		{"f81d4fae-7dec-11d0-a765-00a0c91e6bf", "a UUID must have 32 hex digits"},
+		{"f81d4fae7-dec-11d0-a765-00a0c91e6bf6", "the hyphens are not in the right places"},
+		{"{f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "the braces are not balanced"},
+		{"g81d4fae-7dec-11d0-a765-00a0c91e6bf6", "a UUID can only contain hex digits"},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		_, err := ParseUUID(test.s)
+		if d.Is(err != nil, true, "got an error parsing %q", test.s) {
+			d.Is(err.Error(), test.expect, "error for %q", test.s)
+		}
+	}
+}
+
+func TestUUIDTime(t *testing.T) {
+	tests := []struct {
+		s       string
+		version int
+		time    int64
+		ok      bool
+	}{
+		// These are the examples from RFC 4122 and RFC 9562. The v1 and v6
+		// examples are for the same time.
+		{"f81d4fae-7dec-11d0-a765-00a0c91e6bf6", 1, 0x1d07decf81d4fae, true},
+		{"C232AB00-9414-11EC-B3C8-9F6BDECED846", 1, 0x1ec9414c232ab00, true},
+		{"1EC9414C-232A-6B00-B3C8-9F6BDECED846", 6, 0x1ec9414c232ab00, true},
+		{"017F22E2-79B0-7CC3-98C4-DC0C0C07398F", 7, 0x017f22e279b0*10000 + gregorianOffset, true},
+		{"919108f7-52d1-4320-9bac-f847db4148a8", 4, 0, false},
+		// This has a version 1 nibble, but not the RFC 4122 variant.
+		{"f81d4fae-7dec-11d0-0765-00a0c91e6bf6", 1, 0, false},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		u, err := ParseUUID(test.s)
+		d.Is(err, nil, "no error parsing %q", test.s)
+		d.Is(u.Version(), test.version, "version of %q", test.s)
+		ts, ok := u.Time()
+		d.Is(ok, test.ok, "%q has a timestamp", test.s)
+		d.Is(ts, test.time, "timestamp of %q", test.s)
+	}
+}
+
+func TestParseULID(t *testing.T) {
+	d := detest.New(t)
+	for _, s := range []string{"01ARZ3NDEKTSV4RRFFQ69G5FAV", "01arz3ndektsv4rrffq69g5fav"} {
+		u, err := ParseULID(s)
+		d.Is(err, nil, "no error parsing %q", s)
+		d.Is(u.String(), "01ARZ3NDEKTSV4RRFFQ69G5FAV", "canonical form of %q", s)
+		d.Is(u[:6], []byte{0x01, 0x56, 0x3e, 0x3a, 0xb5, 0xd3}, "timestamp of %q", s)
+	}
+
+	u, err := ParseULID("7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	d.Is(err, nil, "no error parsing the largest ULID")
+	d.Is(u.String(), "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", "canonical form of the largest ULID")
+}
+
+func TestParseULIDErrors(t *testing.T) {
+	tests := []struct {
+		s      string
+		expect string
+	}{
+		{"01ARZ3NDEKTSV4RRFFQ69G5FA", "a ULID must have 26 characters"},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAU", "'U' is not a valid ULID character"},
+		{"81ARZ3NDEKTSV4RRFFQ69G5FAV", "the ULID is too large"},
+	}
+
+	d := detest.New(t)
+	for _, test := range tests {
+		_, err := ParseULID(test.s)
+		if d.Is(err != nil, true, "got an error parsing %q", test.s) {
+			d.Is(err.Error(), test.expect, "error for %q", test.s)
+		}
+	}
+}
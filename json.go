@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/houseabsolute/omegasort/internal/jsondoc"
+	"github.com/houseabsolute/omegasort/internal/jsonpath"
+)
+
+// runJSON sorts a JSON document. Unlike other formats, we don't sort the
+// lines of the file. Instead we sort the arrays and objects at the paths
+// given by --path, as well as the keys of every object if
+// --sort-keys was given.
+func (o *omegasort) runJSON() error {
+	content, err := ioutil.ReadFile(o.opts.file)
+	if err != nil {
+		return err
+	}
+
+	doc, err := jsondoc.Decode(content)
+	if err != nil {
+		return fmt.Errorf("could not parse the file as JSON: %w", err)
+	}
+
+	// We compare the document before and after sorting, rather than
+	// comparing to the original content, so that we don't rewrite a sorted
+	// file just because we format it a little differently.
+	before, err := doc.Encode()
+	if err != nil {
+		return err
+	}
+
+	if err := o.sortJSON(doc); err != nil {
+		return err
+	}
+
+	if o.opts.check {
+		return nil
+	}
+
+	after, err := doc.Encode()
+	if err != nil {
+		return err
+	}
+
+	return o.writeOutput(!bytes.Equal(before, after), func(out io.Writer) error {
+		_, err := out.Write(after)
+		return err
+	})
+}
+
+func (o *omegasort) sortJSON(doc *jsondoc.Document) error {
+	if o.opts.sortAllKeys {
+		if err := o.sortAllJSONKeys(doc.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, expr := range o.opts.paths {
+		path, err := jsonpath.Parse(expr)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		doc.Value, err = path.Update(doc.Value, func(v interface{}) (interface{}, error) {
+			found = true
+			switch t := v.(type) {
+			case *jsondoc.Array:
+				return t, o.sortJSONArray(path, t)
+			case *jsondoc.Object:
+				return t, o.sortJSONKeys(t)
+			}
+			return nil, fmt.Errorf("the value at %s is not an array or object", path)
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("there is no value at %s", path)
+		}
+	}
+
+	return nil
+}
+
+func (o *omegasort) sortAllJSONKeys(v interface{}) error {
+	switch t := v.(type) {
+	case *jsondoc.Array:
+		for _, elem := range t.Elements() {
+			if err := o.sortAllJSONKeys(elem); err != nil {
+				return err
+			}
+		}
+	case *jsondoc.Object:
+		if err := o.sortJSONKeys(t); err != nil {
+			return err
+		}
+		for _, k := range t.Keys() {
+			val, _ := t.Get(k)
+			if err := o.sortAllJSONKeys(val); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortJSONKeys sorts an object's keys with the --sort approach.
+func (o *omegasort) sortJSONKeys(obj *jsondoc.Object) error {
+	names := obj.Keys()
+	order, err := o.sortKeyNames(names)
+	if err != nil || order == nil {
+		return err
+	}
+
+	sorted := make([]string, len(order))
+	for i, idx := range order {
+		sorted[i] = names[idx]
+	}
+	obj.SetKeys(sorted)
+
+	return nil
+}
+
+// sortJSONArray sorts an array's elements using the sort keys.
+func (o *omegasort) sortJSONArray(path jsonpath.Path, arr *jsondoc.Array) error {
+	elements := arr.Elements()
+	values := make([]string, len(elements))
+	for i, elem := range elements {
+		v, err := jsondoc.EncodeValue(elem)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+
+	order, err := o.sortElements(path, values)
+	if err != nil || order == nil {
+		return err
+	}
+
+	sorted := make([]interface{}, len(order))
+	for i, idx := range order {
+		sorted[i] = elements[idx]
+	}
+	arr.SetElements(sorted)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/houseabsolute/omegasort/internal/jsonpath"
+	"github.com/houseabsolute/omegasort/internal/sorters"
+)
+
+// jsonPathExtractor is a sorters.Extractor that parses each value as JSON
+// and extracts the value at a path.
+type jsonPathExtractor struct {
+	path jsonpath.Path
+}
+
+func newJSONPathExtractor(expr string) (jsonPathExtractor, error) {
+	path, err := jsonpath.Parse(expr)
+	if err != nil {
+		return jsonPathExtractor{}, err
+	}
+	return jsonPathExtractor{path}, nil
+}
+
+func (jpe jsonPathExtractor) Extract(value string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	// We want numbers exactly as they appear in the input, not as they'd be
+	// formatted after parsing them into a float64.
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	found, ok := jpe.path.Lookup(v)
+	if !ok || found == nil {
+		return "", sorters.NoMatchError{
+			Message: fmt.Sprintf("'%s' does not have a value at %s", value, jpe.path),
+		}
+	}
+
+	return jsonValueString(found)
+}
+
+// jsonValueString turns a JSON value into the string that is passed to the
+// sort approach. Strings are used as-is, and everything else is turned
+// into its JSON representation.
+func jsonValueString(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
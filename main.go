@@ -9,10 +9,12 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eidolon/wordwrap"
+	"github.com/houseabsolute/omegasort/internal/jsonpath"
 	"github.com/houseabsolute/omegasort/internal/sorters"
 	"golang.org/x/term"
 	"golang.org/x/text/language"
@@ -22,20 +24,66 @@ import (
 var version = "0.0.6"
 
 type omegasort struct {
-	opts       *opts
-	app        *kingpin.Application
-	sort       sorters.Approach
-	locale     language.Tag
+	opts   *opts
+	app    *kingpin.Application
+	sort   sorters.Approach
+	locale language.Tag
+	// datetimeLayouts and location are set from the --datetime-format and
+	// --timezone flags.
+	datetimeLayouts []string
+	location        *time.Location
+	keys            []sorters.Key
+	// keyColumns maps the index of a key in keys to the CSV column name
+	// given for that key. These are turned into field numbers once the
+	// header has been read.
+	keyColumns map[int]string
 	lineEnding []byte
+	// separator is set from the --null-data or --record-separator flag.
+	// When it is set it is used instead of the file's line ending.
+	separator []byte
 }
 
 type opts struct {
 	sort            string
+	format          string
 	locale          string
 	unique          bool
 	caseInsensitive bool
 	reverse         bool
 	windows         bool
+	normalizeURLs   bool
+	ports           string
+	ipFamilies      string
+	mappedAsV4      bool
+	uuidTimeOrder   bool
+	datetimeFormats []string
+	timezone        string
+	dateOrder       string
+	collapse        bool
+	splitRanges     bool
+	checkOverlaps   bool
+	hostBits        string
+	display         string
+	canonicalize    bool
+	keys            []string
+	keyRegex        string
+	unmatched       string
+	jsonMissing     string
+	paths           []string
+	sortAllKeys     bool
+	sortSections    bool
+	records         string
+	recordStart     string
+	nullData        bool
+	recordSep       string
+	commentPrefix   string
+	attachBlank     bool
+	headerLines     int
+	footerLines     int
+	keepLeading     string
+	countLine       bool
+	groups          bool
+	uniqueByKey     bool
 	inPlace         bool
 	toStdout        bool
 	check           bool
@@ -69,6 +117,60 @@ func main() {
 			os.Exit(1)
 		}
 
+		var gnsErr groupNotSortedError
+		if errors.As(err, &gnsErr) {
+			_, err = os.Stderr.WriteString(fmt.Sprintf("The %s file is not sorted: %s\n", o.opts.file, gnsErr))
+			if err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+
+		var oErr overlapError
+		if errors.As(err, &oErr) {
+			_, err = os.Stderr.WriteString(fmt.Sprintf("The %s file has overlapping networks:\n%s\n", o.opts.file, oErr))
+			if err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+
+		var ncanErr notCanonicalError
+		if errors.As(err, &ncanErr) {
+			_, err = os.Stderr.WriteString(fmt.Sprintf("The %s file is not canonical: %s\n", o.opts.file, ncanErr))
+			if err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+
+		var hbErr hostBitsError
+		if errors.As(err, &hbErr) {
+			_, err = os.Stderr.WriteString(fmt.Sprintf("The %s file has host bits set: %s\n", o.opts.file, hbErr))
+			if err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+
+		var ncErr notCollapsedError
+		if errors.As(err, &ncErr) {
+			_, err = os.Stderr.WriteString(fmt.Sprintf("The %s file is not collapsed: %s\n", o.opts.file, ncErr))
+			if err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+
+		var wcErr wrongCountError
+		if errors.As(err, &wcErr) {
+			_, err = os.Stderr.WriteString(fmt.Sprintf("The %s file has the wrong count: %s\n", o.opts.file, wcErr))
+			if err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+
 		_, err = os.Stderr.WriteString(fmt.Sprintf("error when sorting %s: %s\n", o.opts.file, err))
 		if err != nil {
 			panic(err)
@@ -97,6 +199,10 @@ func new() (*omegasort, error) {
 		"sort",
 		"The type of sorting to use. See below for options.",
 	).Short('s').HintOptions(validSorts...).Enum(validSorts...)
+	format := app.Flag(
+		"format",
+		"The format of the file. This can be \"lines\", \"csv\", \"tsv\", \"jsonl\", \"json\", \"yaml\", \"toml\", or \"ini\".",
+	).Default("lines").Enum("lines", "csv", "tsv", "jsonl", "json", "yaml", "toml", "ini")
 	locale := app.Flag(
 		"locale",
 		"The locale to use for sorting. If this is not specified the sorting is in codepoint order.",
@@ -105,6 +211,10 @@ func new() (*omegasort, error) {
 		"unique",
 		"Make the file contents unique, or check that they're unique when used with --check.",
 	).Short('u').Default("false").Bool()
+	uniqueByKey := app.Flag(
+		"unique-by-key",
+		"Like --unique, but lines are duplicates when their sort keys are equal, rather than when the whole line is the same.",
+	).Default("false").Bool()
 	caseInsensitive := app.Flag(
 		"case-insensitive",
 		"Sort case-insensitively. Note that many locales always do this so if you specify"+
@@ -118,6 +228,153 @@ func new() (*omegasort, error) {
 		"windows",
 		"Parse paths as Windows paths for path sort.",
 	).Default("false").Bool()
+	normalizeURLs := app.Flag(
+		"normalize-urls",
+		"Normalize URLs before comparing them for url sort.",
+	).Default("false").Bool()
+	ports := app.Flag(
+		"ports",
+		"Whether addresses can have a port for ip sort. This can be \"allow\", \"require\", or \"forbid\".",
+	).Default("allow").Enum("allow", "require", "forbid")
+	ipFamilies := app.Flag(
+		"ip-families",
+		"How to order IPv4 and IPv6 addresses for ip sort. This can be \"mixed\", \"v4-first\", or \"v6-first\".",
+	).Default("mixed").Enum("mixed", "v4-first", "v6-first")
+	mappedAsV4 := app.Flag(
+		"mapped-as-v4",
+		"Treat IPv4-mapped IPv6 addresses, like ::ffff:10.0.0.1, as the IPv4 addresses they map to for ip sort.",
+	).Default("false").Bool()
+	uuidTimeOrder := app.Flag(
+		"uuid-time-order",
+		"Sort v1, v6, and v7 UUIDs by the timestamp in them for uuid sort.",
+	).Default("false").Bool()
+	datetimeFormats := app.Flag(
+		"datetime-format",
+		"A format for the datetimes in datetime-text sort, either as a strftime format like \"%d/%m/%Y\" or a Go"+
+			" layout like \"02/01/2006\". This can be given more than once.",
+	).Strings()
+	timezone := app.Flag(
+		"timezone",
+		"The time zone for datetimes without one in datetime-text sort, like \"Europe/Berlin\" or \"+02:00\"."+
+			" The default is the local time zone.",
+	).Default("").String()
+	dateOrder := app.Flag(
+		"date-order",
+		"How to read dates like 01/02/2020 in datetime-text sort. This can be \"strict\", \"month-first\", or"+
+			" \"day-first\".",
+	).Default("strict").Enum("strict", "month-first", "day-first")
+	collapse := app.Flag(
+		"collapse",
+		"Replace the networks in the file with the smallest list of networks that covers the same addresses."+
+			" This can only be used with --sort network.",
+	).Default("false").Bool()
+	splitRanges := app.Flag(
+		"split-ranges",
+		"Replace each range of addresses and each address with a mask with the networks in CIDR form that cover it."+
+			" This can only be used with --sort network.",
+	).Default("false").Bool()
+	checkOverlaps := app.Flag(
+		"check-overlaps",
+		"Exit with an error listing every pair of networks where one network contains another. This can only be used"+
+			" with --sort network.",
+	).Default("false").Bool()
+	hostBits := app.Flag(
+		"host-bits",
+		"What to do with networks that have host bits set, like 10.0.0.5/24, for network sort. This can be"+
+			" \"allow\", \"error\", \"warn\", or \"clear\".",
+	).Default("allow").Enum("allow", "error", "warn", "clear")
+	display := app.Flag(
+		"display",
+		"How to write each value when the approach has a canonical form. This can be \"canonical\" or \"original\"."+
+			" The default is \"canonical\" for ip-or-network sort and \"original\" for other approaches.",
+	).Enum("canonical", "original")
+	canonicalize := app.Flag(
+		"canonicalize",
+		"Rewrite each value in its canonical form, with IPv6 addresses written as described in RFC 5952"+
+			" and MAC addresses written with colons."+
+			" This is the same as --display canonical.",
+	).Default("false").Bool()
+	keys := app.Flag(
+		"key",
+		"A key to sort on, in the form FIELD[,APPROACH][,OPTION...]. This can be given more than once."+
+			" A key with options ignores --reverse and --case-insensitive but uses the other global flags."+
+			" See the extended docs for details.",
+	).Short('k').Strings()
+	keyRegex := app.Flag(
+		"key-regex",
+		"A regular expression used to extract the sort key from each line. The key is the capture group"+
+			" named \"key\", or the first named capture group, or the first capture group.",
+	).Default("").String()
+	unmatched := app.Flag(
+		"key-regex-unmatched",
+		"What to do with lines that do not match the --key-regex. This can be \"first\", \"last\", or \"error\".",
+	).Default("error").Enum("first", "last", "error")
+	jsonMissing := app.Flag(
+		"json-missing",
+		"What to do with JSON values that do not have a value at a key's path. This can be \"first\", \"last\", or \"error\".",
+	).Default("error").Enum("first", "last", "error")
+	paths := app.Flag(
+		"path",
+		"The path to an array or object to sort when using --format json, yaml, or toml. This can be given more than once.",
+	).Strings()
+	sortAllKeys := app.Flag(
+		"sort-keys",
+		"Sort the keys of every object when using --format json or yaml, or of every section when using --format toml or ini.",
+	).Default("false").Bool()
+	sortSections := app.Flag(
+		"sort-sections",
+		"Sort the sections of the file by name when using --format toml or ini.",
+	).Default("false").Bool()
+	records := app.Flag(
+		"records",
+		"How to split the file into records. This can be \"lines\", \"paragraphs\" for records separated by blank lines,"+
+			" or \"indented\" for records which start at column 0 and continue on indented lines.",
+	).Default("lines").Enum("lines", "paragraphs", "indented")
+	recordStart := app.Flag(
+		"record-start",
+		"A regular expression which matches the first line of each record. Lines up to the next match are part of the same record.",
+	).Default("").String()
+	nullData := app.Flag(
+		"null-data",
+		"Items in the file are separated by NUL bytes instead of line endings. This works with the output of commands like \"find -print0\".",
+	).Short('z').Default("false").Bool()
+	recordSep := app.Flag(
+		"record-separator",
+		"A string which separates items in the file instead of line endings. This can contain escapes like \"\\t\" or \"\\x1e\".",
+	).Default("").String()
+	commentPrefix := app.Flag(
+		"comment-prefix",
+		"Lines starting with this prefix, like \"#\" or \"//\", are comments. Each comment is attached to the next line that"+
+			" is not a comment and moves with it.",
+	).Default("").String()
+	attachBlank := app.Flag(
+		"attach-blank-lines",
+		"With --comment-prefix, blank lines are also attached to the next line that is not a comment, instead of staying"+
+			" where they are.",
+	).Default("false").Bool()
+	headerLines := app.Flag(
+		"header-lines",
+		"The number of lines at the start of the file which are never sorted.",
+	).Default("0").Int()
+	footerLines := app.Flag(
+		"footer-lines",
+		"The number of lines at the end of the file which are never sorted.",
+	).Default("0").Int()
+	keepLeading := app.Flag(
+		"keep-leading",
+		"A regular expression for lines at the start of the file which are never sorted. Lines are kept until the first"+
+			" line which does not match.",
+	).Default("").String()
+	countLine := app.Flag(
+		"count-line",
+		"The first line of the file is a count of the items in it, like in a hunspell .dic file. This line is never"+
+			" sorted, and it is updated when --unique removes items.",
+	).Default("false").Bool()
+	groups := app.Flag(
+		"groups",
+		"Sort each group of lines separated by blank lines on its own. With --comment-prefix, comments at the start of a"+
+			" group are its heading and stay at the top of the group.",
+	).Default("false").Bool()
 	inPlace := app.Flag(
 		"in-place",
 		"Modify the file in place instead of making a backup.",
@@ -160,18 +417,49 @@ func new() (*omegasort, error) {
 	}
 
 	appOpts.sort = *sortType
-	for _, as := range sorters.AvailableSorts {
-		if as.Name == appOpts.sort {
-			o.sort = as
-			break
-		}
+	if appOpts.sort != "" {
+		o.sort, _ = sorters.ApproachByName(appOpts.sort)
 	}
 
+	appOpts.format = *format
 	appOpts.locale = *locale
 	appOpts.unique = *unique
+	appOpts.uniqueByKey = *uniqueByKey
 	appOpts.caseInsensitive = *caseInsensitive
 	appOpts.reverse = *reverse
 	appOpts.windows = *windows
+	appOpts.normalizeURLs = *normalizeURLs
+	appOpts.ports = *ports
+	appOpts.ipFamilies = *ipFamilies
+	appOpts.mappedAsV4 = *mappedAsV4
+	appOpts.uuidTimeOrder = *uuidTimeOrder
+	appOpts.datetimeFormats = *datetimeFormats
+	appOpts.timezone = *timezone
+	appOpts.dateOrder = *dateOrder
+	appOpts.collapse = *collapse
+	appOpts.splitRanges = *splitRanges
+	appOpts.checkOverlaps = *checkOverlaps
+	appOpts.hostBits = *hostBits
+	appOpts.display = *display
+	appOpts.canonicalize = *canonicalize
+	appOpts.keys = *keys
+	appOpts.keyRegex = *keyRegex
+	appOpts.unmatched = *unmatched
+	appOpts.jsonMissing = *jsonMissing
+	appOpts.paths = *paths
+	appOpts.sortAllKeys = *sortAllKeys
+	appOpts.sortSections = *sortSections
+	appOpts.records = *records
+	appOpts.recordStart = *recordStart
+	appOpts.nullData = *nullData
+	appOpts.recordSep = *recordSep
+	appOpts.commentPrefix = *commentPrefix
+	appOpts.attachBlank = *attachBlank
+	appOpts.headerLines = *headerLines
+	appOpts.footerLines = *footerLines
+	appOpts.keepLeading = *keepLeading
+	appOpts.countLine = *countLine
+	appOpts.groups = *groups
 	appOpts.inPlace = *inPlace
 	appOpts.toStdout = *toStdout
 	appOpts.check = *check
@@ -204,7 +492,7 @@ func sortDocs() string {
 }
 
 func (o *omegasort) validateArgs() error {
-	if o.opts.sort == "" {
+	if o.opts.sort == "" && len(o.opts.keys) == 0 {
 		return errors.New("you must set a --sort method")
 	}
 
@@ -212,10 +500,117 @@ func (o *omegasort) validateArgs() error {
 		return errors.New("you must pass a file to sort as the final argument")
 	}
 
-	if o.opts.locale != "" && !o.sort.SupportsLocale {
+	if o.opts.locale != "" && o.opts.sort != "" && !o.sort.SupportsLocale {
 		return fmt.Errorf("you cannot set a locale when sorting by %s", o.sort.Name)
 	}
 
+	if o.opts.keyRegex != "" && o.keysArePaths() {
+		return fmt.Errorf("you cannot use --key-regex with --format %s", o.opts.format)
+	}
+
+	if err := o.validateStructuredArgs(); err != nil {
+		return err
+	}
+
+	if err := o.setSeparator(); err != nil {
+		return err
+	}
+
+	if o.hasPinnedLines() {
+		if o.opts.format != "lines" && o.opts.format != "jsonl" {
+			return fmt.Errorf(
+				"you cannot use --header-lines, --footer-lines, --keep-leading, or --count-line with --format %s",
+				o.opts.format,
+			)
+		}
+		if o.opts.headerLines < 0 || o.opts.footerLines < 0 {
+			return errors.New("the --header-lines and --footer-lines flags cannot be negative")
+		}
+	}
+
+	if o.opts.groups {
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --groups with --format %s", o.opts.format)
+		}
+		if o.opts.records != "lines" || o.opts.recordStart != "" {
+			return errors.New("you cannot use --groups with --records or --record-start")
+		}
+		if o.opts.attachBlank {
+			return errors.New("you cannot use --groups with --attach-blank-lines, since blank lines separate the groups")
+		}
+	}
+
+	if o.opts.collapse {
+		if o.opts.sort != "network" || len(o.opts.keys) > 0 || o.opts.keyRegex != "" {
+			return errors.New("you can only use --collapse with --sort network and without --key or --key-regex")
+		}
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --collapse with --format %s", o.opts.format)
+		}
+		if o.opts.records != "lines" || o.opts.recordStart != "" || o.opts.commentPrefix != "" {
+			return errors.New("you cannot use --collapse with --records, --record-start, or --comment-prefix")
+		}
+	}
+
+	if o.opts.splitRanges {
+		if o.opts.sort != "network" || len(o.opts.keys) > 0 || o.opts.keyRegex != "" {
+			return errors.New("you can only use --split-ranges with --sort network and without --key or --key-regex")
+		}
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --split-ranges with --format %s", o.opts.format)
+		}
+		if o.opts.records != "lines" || o.opts.recordStart != "" || o.opts.commentPrefix != "" {
+			return errors.New("you cannot use --split-ranges with --records, --record-start, or --comment-prefix")
+		}
+	}
+
+	if o.opts.checkOverlaps {
+		if o.opts.sort != "network" || len(o.opts.keys) > 0 || o.opts.keyRegex != "" {
+			return errors.New("you can only use --check-overlaps with --sort network and without --key or --key-regex")
+		}
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --check-overlaps with --format %s", o.opts.format)
+		}
+		if o.opts.records != "lines" || o.opts.recordStart != "" {
+			return errors.New("you cannot use --check-overlaps with --records or --record-start")
+		}
+	}
+
+	if o.opts.hostBits != "allow" {
+		if o.opts.sort != "network" || !o.wholeLineIsValue() {
+			return errors.New(
+				"you can only use --host-bits with --sort network and without --key, --key-regex, --records, or --record-start",
+			)
+		}
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --host-bits with --format %s", o.opts.format)
+		}
+	}
+
+	if err := o.validateDisplay(); err != nil {
+		return err
+	}
+
+	if o.opts.commentPrefix != "" {
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --comment-prefix with --format %s", o.opts.format)
+		}
+		if o.opts.records != "lines" || o.opts.recordStart != "" {
+			return errors.New("you cannot use --comment-prefix with --records or --record-start")
+		}
+	} else if o.opts.attachBlank {
+		return errors.New("you can only use --attach-blank-lines with --comment-prefix")
+	}
+
+	if o.opts.records != "lines" || o.opts.recordStart != "" {
+		if o.opts.format != "lines" {
+			return fmt.Errorf("you cannot use --records or --record-start with --format %s", o.opts.format)
+		}
+		if o.opts.records != "lines" && o.opts.recordStart != "" {
+			return errors.New("you cannot set both --records and --record-start")
+		}
+	}
+
 	if o.opts.toStdout && o.opts.inPlace {
 		return errors.New("you cannot set both --stdout and --in-place")
 	}
@@ -228,10 +623,34 @@ func (o *omegasort) validateArgs() error {
 		return errors.New("you cannot set both --in-place and --check")
 	}
 
-	if o.opts.windows && !o.sort.SupportsPathType {
+	if o.opts.windows && o.opts.sort != "" && !o.sort.SupportsPathType {
 		return fmt.Errorf("you cannot pass the --windows flag when sorting by %s", o.sort.Name)
 	}
 
+	if o.opts.normalizeURLs && o.opts.sort != "" && o.sort.Name != "url" {
+		return fmt.Errorf("you cannot pass the --normalize-urls flag when sorting by %s", o.sort.Name)
+	}
+
+	if o.opts.ports != "allow" && o.opts.sort != "" && o.sort.Name != "ip" {
+		return fmt.Errorf("you cannot pass the --ports flag when sorting by %s", o.sort.Name)
+	}
+
+	if o.opts.ipFamilies != "mixed" && o.opts.sort != "" && o.sort.Name != "ip" {
+		return fmt.Errorf("you cannot pass the --ip-families flag when sorting by %s", o.sort.Name)
+	}
+
+	if o.opts.mappedAsV4 && o.opts.sort != "" && o.sort.Name != "ip" {
+		return fmt.Errorf("you cannot pass the --mapped-as-v4 flag when sorting by %s", o.sort.Name)
+	}
+
+	if o.opts.uuidTimeOrder && o.opts.sort != "" && o.sort.Name != "uuid" {
+		return fmt.Errorf("you cannot pass the --uuid-time-order flag when sorting by %s", o.sort.Name)
+	}
+
+	if err := o.validateDatetime(); err != nil {
+		return err
+	}
+
 	if o.opts.locale != "" {
 		tag, err := language.Parse(o.opts.locale)
 		if err != nil {
@@ -240,9 +659,287 @@ func (o *omegasort) validateArgs() error {
 		o.locale = tag
 	}
 
+	return o.makeKeys()
+}
+
+var portPolicies = map[string]sorters.PortPolicy{
+	"allow":   sorters.PortsAllowed,
+	"require": sorters.PortsRequired,
+	"forbid":  sorters.PortsForbidden,
+}
+
+var ipFamilyOrders = map[string]sorters.IPFamilyOrder{
+	"mixed":    sorters.IPFamiliesMixed,
+	"v4-first": sorters.IPv4First,
+	"v6-first": sorters.IPv6First,
+}
+
+var unmatchedPolicies = map[string]sorters.UnmatchedPolicy{
+	"error": sorters.UnmatchedError,
+	"first": sorters.UnmatchedFirst,
+	"last":  sorters.UnmatchedLast,
+}
+
+func (o *omegasort) sortParams() sorters.SortParams {
+	p := sorters.SortParams{
+		Locale:          o.locale,
+		CaseInsensitive: o.opts.caseInsensitive,
+		Reverse:         o.opts.reverse,
+	}
+	if o.opts.windows {
+		p.PathType = sorters.WindowsPaths
+	}
+	p.NormalizeURLs = o.opts.normalizeURLs
+	p.Ports = portPolicies[o.opts.ports]
+	p.IPFamilies = ipFamilyOrders[o.opts.ipFamilies]
+	p.MappedAsIPv4 = o.opts.mappedAsV4
+	p.UUIDTimeOrder = o.opts.uuidTimeOrder
+	p.DatetimeLayouts = o.datetimeLayouts
+	p.Location = o.location
+	p.DateOrder = dateOrders[o.opts.dateOrder]
+
+	return p
+}
+
+func (o *omegasort) makeKeys() error {
+	var keyRegex sorters.Extractor
+	if o.opts.keyRegex != "" {
+		var err error
+		keyRegex, err = sorters.NewKeyRegex(o.opts.keyRegex)
+		if err != nil {
+			return err
+		}
+	}
+	unmatched := unmatchedPolicies[o.opts.unmatched]
+
+	if len(o.opts.keys) == 0 && o.isStructured() {
+		// Array elements are passed to the keys as JSON, so we need to
+		// extract the value to sort on even when it's a plain string.
+		o.keys = []sorters.Key{
+			{
+				Extractor: jsonPathExtractor{jsonpath.MustParse(".")},
+				Unmatched: unmatchedPolicies[o.opts.jsonMissing],
+				Approach:  o.sort,
+				Params:    o.sortParams(),
+			},
+		}
+		return nil
+	}
+
+	if len(o.opts.keys) == 0 {
+		o.keys = []sorters.Key{
+			{
+				Extractor: keyRegex,
+				Unmatched: unmatched,
+				Approach:  o.sort,
+				Params:    o.sortParams(),
+			},
+		}
+		return nil
+	}
+
+	for _, spec := range o.opts.keys {
+		key, name, err := o.parseKey(spec)
+		if err != nil {
+			return err
+		}
+
+		key.Extractor = keyRegex
+		key.Unmatched = unmatched
+		switch {
+		case o.keysArePaths():
+			key.Extractor, err = newJSONPathExtractor(name)
+			if err != nil {
+				return err
+			}
+			key.Unmatched = unmatchedPolicies[o.opts.jsonMissing]
+		case name != "":
+			if o.keyColumns == nil {
+				o.keyColumns = map[int]string{}
+			}
+			o.keyColumns[len(o.keys)] = name
+		}
+
+		o.keys = append(o.keys, key)
+	}
+
 	return nil
 }
 
+// parseKey parses a key spec like "3,datetime-text,reverse". Keys without
+// an approach use the --sort approach. Each key starts with the params from
+// the global flags, like --locale and --timezone, and its options override
+// those. Like GNU sort, the ordering flags, --reverse and
+// --case-insensitive, only apply to keys without any options. Otherwise
+// there would be no way to sort one key forward and another in reverse.
+//
+// When sorting a CSV file the field can be a column name instead of a
+// number, and when sorting JSON or JSON Lines the field is always a path. In
+// those cases the name or path is returned as the second value.
+func (o *omegasort) parseKey(spec string) (sorters.Key, string, error) {
+	parts := strings.Split(spec, ",")
+
+	var name string
+	field, err := strconv.Atoi(parts[0])
+	switch {
+	case o.keysArePaths():
+		field = 0
+		name = parts[0]
+	case err != nil || field < 0:
+		if !o.isCSV() || parts[0] == "" {
+			return sorters.Key{}, "", fmt.Errorf("the key %q does not start with a valid field number", spec)
+		}
+		name = parts[0]
+	}
+
+	key := sorters.Key{
+		Field:    field,
+		Approach: o.sort,
+		Params:   o.sortParams(),
+	}
+
+	hasApproach := o.opts.sort != ""
+	var options []string
+	for _, part := range parts[1:] {
+		if as, ok := sorters.ApproachByName(part); ok {
+			key.Approach = as
+			hasApproach = true
+			continue
+		}
+		options = append(options, part)
+	}
+
+	if !hasApproach {
+		return sorters.Key{}, "", fmt.Errorf("the key %q does not have an approach and no --sort method was set", spec)
+	}
+
+	if len(options) > 0 {
+		key.Params.Reverse = false
+		key.Params.CaseInsensitive = false
+	}
+	var layouts []string
+	for _, opt := range options {
+		switch {
+		case opt == "reverse":
+			key.Params.Reverse = true
+		case opt == "case-insensitive":
+			key.Params.CaseInsensitive = true
+		case opt == "windows":
+			if !key.Approach.SupportsPathType {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the windows option when sorting by %s", key.Approach.Name)
+			}
+			key.Params.PathType = sorters.WindowsPaths
+		case opt == "normalize":
+			if key.Approach.Name != "url" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the normalize option when sorting by %s", key.Approach.Name)
+			}
+			key.Params.NormalizeURLs = true
+		case strings.HasPrefix(opt, "ports="):
+			if key.Approach.Name != "ip" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the ports option when sorting by %s", key.Approach.Name)
+			}
+			policy, ok := portPolicies[strings.TrimPrefix(opt, "ports=")]
+			if !ok {
+				return sorters.Key{}, "", fmt.Errorf("the ports option in the key %q must be allow, require, or forbid", spec)
+			}
+			key.Params.Ports = policy
+		case strings.HasPrefix(opt, "families="):
+			if key.Approach.Name != "ip" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the families option when sorting by %s", key.Approach.Name)
+			}
+			order, ok := ipFamilyOrders[strings.TrimPrefix(opt, "families=")]
+			if !ok {
+				return sorters.Key{}, "", fmt.Errorf("the families option in the key %q must be mixed, v4-first, or v6-first", spec)
+			}
+			key.Params.IPFamilies = order
+		case opt == "mapped-as-v4":
+			if key.Approach.Name != "ip" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the mapped-as-v4 option when sorting by %s", key.Approach.Name)
+			}
+			key.Params.MappedAsIPv4 = true
+		case opt == "time-order":
+			if key.Approach.Name != "uuid" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the time-order option when sorting by %s", key.Approach.Name)
+			}
+			key.Params.UUIDTimeOrder = true
+		case opt == "month-first" || opt == "day-first":
+			if key.Approach.Name != "datetime-text" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the %s option when sorting by %s", opt, key.Approach.Name)
+			}
+			key.Params.DateOrder = dateOrders[opt]
+		case strings.HasPrefix(opt, "format="):
+			if key.Approach.Name != "datetime-text" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the format option when sorting by %s", key.Approach.Name)
+			}
+			layout, lerr := sorters.DatetimeLayout(strings.TrimPrefix(opt, "format="))
+			if lerr != nil {
+				return sorters.Key{}, "", lerr
+			}
+			layouts = append(layouts, layout)
+		case strings.HasPrefix(opt, "timezone="):
+			if key.Approach.Name != "datetime-text" {
+				return sorters.Key{}, "", fmt.Errorf("you cannot use the timezone option when sorting by %s", key.Approach.Name)
+			}
+			loc, lerr := sorters.ParseTimezone(strings.TrimPrefix(opt, "timezone="))
+			if lerr != nil {
+				return sorters.Key{}, "", lerr
+			}
+			key.Params.Location = loc
+		case strings.HasPrefix(opt, "locale="):
+			if !key.Approach.SupportsLocale {
+				return sorters.Key{}, "", fmt.Errorf("you cannot set a locale when sorting by %s", key.Approach.Name)
+			}
+			locale := strings.TrimPrefix(opt, "locale=")
+			tag, lerr := language.Parse(locale)
+			if lerr != nil {
+				return sorters.Key{}, "", fmt.Errorf("could not find a locale matching %s: %s", locale, lerr)
+			}
+			key.Params.Locale = tag
+		default:
+			return sorters.Key{}, "", fmt.Errorf("the key %q contains an unknown approach or option, %q", spec, opt)
+		}
+	}
+	if len(layouts) > 0 {
+		key.Params.DatetimeLayouts = layouts
+	}
+
+	if len(options) == 0 {
+		if o.opts.locale != "" && !key.Approach.SupportsLocale {
+			return sorters.Key{}, "", fmt.Errorf("you cannot set a locale when sorting by %s", key.Approach.Name)
+		}
+		if o.opts.windows && !key.Approach.SupportsPathType {
+			return sorters.Key{}, "", fmt.Errorf("you cannot pass the --windows flag when sorting by %s", key.Approach.Name)
+		}
+		if o.opts.normalizeURLs && key.Approach.Name != "url" {
+			return sorters.Key{}, "", fmt.Errorf("you cannot pass the --normalize-urls flag when sorting by %s", key.Approach.Name)
+		}
+		if o.opts.ports != "allow" && key.Approach.Name != "ip" {
+			return sorters.Key{}, "", fmt.Errorf("you cannot pass the --ports flag when sorting by %s", key.Approach.Name)
+		}
+		if o.opts.ipFamilies != "mixed" && key.Approach.Name != "ip" {
+			return sorters.Key{}, "", fmt.Errorf("you cannot pass the --ip-families flag when sorting by %s", key.Approach.Name)
+		}
+		if o.opts.mappedAsV4 && key.Approach.Name != "ip" {
+			return sorters.Key{}, "", fmt.Errorf("you cannot pass the --mapped-as-v4 flag when sorting by %s", key.Approach.Name)
+		}
+		if o.opts.uuidTimeOrder && key.Approach.Name != "uuid" {
+			return sorters.Key{}, "", fmt.Errorf("you cannot pass the --uuid-time-order flag when sorting by %s", key.Approach.Name)
+		}
+		if key.Approach.Name != "datetime-text" {
+			switch {
+			case len(o.opts.datetimeFormats) > 0:
+				return sorters.Key{}, "", fmt.Errorf("you cannot pass the --datetime-format flag when sorting by %s", key.Approach.Name)
+			case o.opts.timezone != "":
+				return sorters.Key{}, "", fmt.Errorf("you cannot pass the --timezone flag when sorting by %s", key.Approach.Name)
+			case o.opts.dateOrder != "strict":
+				return sorters.Key{}, "", fmt.Errorf("you cannot pass the --date-order flag when sorting by %s", key.Approach.Name)
+			}
+		}
+	}
+
+	return key, name, nil
+}
+
 // nolint: lll
 var extendedSortDocs = `There are a number of different sorting methods available.
 
@@ -280,24 +977,242 @@ This sorting method assumes that each line starts with a date or datetime, witho
 
 Lines should not have any leading space before the datetime.
 
-This sorting method accepts the --locale, --case-insensitive, and --reverse flags.
+By default the format of each datetime is guessed. A date like 01/02/2020 could be January 2 or February 1, so a date where the month could come before or after the day is an error unless you pass "--date-order month-first" or "--date-order day-first". A date like 13/02/2020 can only be read one way, so it is not an error.
+
+If you pass --datetime-format then each line must start with a datetime in that format. The format can be a strftime format like "%d/%m/%Y %H:%M" or a Go layout like "02/01/2006 15:04". A format can contain spaces. You can pass this flag more than once, in which case each format is tried in order. A line which starts with a digit but does not match any of the formats is an error.
+
+Datetimes without a time zone are in the local time zone. You can pass --timezone to use a different time zone, either a name like "Europe/Berlin" or an offset from UTC between -14:00 and +14:00, like "+02:00".
+
+This sorting method accepts the --locale, --case-insensitive, --reverse, --datetime-format, --timezone, and --date-order flags.
 
 ## IP Sort
 
 This method assumes that each line is an IPv4 or IPv6 address (not a network).
 
-The sorting method is the same as if each line were the corresponding integer for the address.
+The sorting method is the same as if each line were the corresponding integer for the address. By default an IPv4 address is sorted as if it were the IPv4-mapped IPv6 address for it, so 1.2.3.4 sorts like ::ffff:1.2.3.4, after ::1 and before 2001:db8::1. An IPv4 address comes before the same address written in the IPv4-mapped form.
 
-This sorting method accepts the --reverse flag.
+If you pass "--ip-families v4-first", every IPv4 address comes before every IPv6 address, and if you pass "--ip-families v6-first", every IPv6 address comes first. An IPv4-mapped address like ::ffff:1.2.3.4 is an IPv6 address unless you pass --mapped-as-v4. With --mapped-as-v4 it is the same as the IPv4 address it maps to, both when sorting and for --unique, so ::ffff:1.2.3.4 and 1.2.3.4 are duplicates.
+
+An address can have a port, like "10.0.0.1:8080" or "[2001:db8::1]:443", and an IPv6 address can have a zone, like "fe80::1%eth0". An IPv6 address must be in brackets to have a port. Lines are sorted by the address first, then by the zone, then by the port numerically. Addresses without a zone or port come before addresses with them. If you pass "--ports require" every address must have a port, and if you pass "--ports forbid" no address can have one.
+
+If you pass --canonicalize, each address is rewritten in its canonical form. IPv6 addresses are lowercased and compressed as described in RFC 5952, so "2001:DB8:0::1" becomes "2001:db8::1". Zones and ports are kept.
+
+This sorting method accepts the --reverse, --ports, --ip-families, --mapped-as-v4, and --canonicalize flags.
 
 ## Network Sort
 
-This method assumes that each line is an IPv4 or IPv6 network in CIDR notation.
+This method assumes that each line is an IPv4 or IPv6 network in CIDR notation. A line can also be a range of addresses, like 10.0.0.0-10.0.0.255, or an IPv4 address followed by a netmask or a wildcard mask, like "10.0.0.0 255.255.255.0" or "10.0.0.0 0.0.0.255". A mask is treated as a netmask if it could be either one.
 
-If there are two networks with the same base address they are sorted with the larger network first (so 1.1.1.0/24 comes before 1.1.1.0/28).
+If there are two networks with the same base address they are sorted with the larger network first (so 1.1.1.0/24 comes before 1.1.1.0/28). Ranges are sorted by their first address in the same way, with larger ranges first.
+
+If you pass --split-ranges, each range and each address with a mask is replaced with the networks in CIDR form that cover exactly the same addresses, so 10.0.0.0-10.0.0.2 becomes 10.0.0.0/31 and 10.0.0.2/32. With --check, every line must already be in CIDR form. You cannot use --split-ranges with --key, --key-regex, --records, or --comment-prefix.
+
+If you pass --collapse, the networks are replaced with the smallest list of networks that covers the same addresses. Networks which are contained in another network are removed, and adjacent networks which make up a larger network are merged, so 10.0.0.0/25 and 10.0.0.128/25 become 10.0.0.0/24. A network which isn't removed or merged keeps its original text. With --check, the file must also be collapsed. You cannot use --collapse with --key, --key-regex, --records, or --comment-prefix.
+
+If you pass --check-overlaps, omegasort exits with an error if any network contains another network or appears more than once, listing every such pair with their line numbers. The file is not changed in that case. This is useful when an overlap is probably a mistake that you want to fix by hand. With --groups, networks in different groups are checked against each other too.
+
+A network like 10.0.0.5/24 has host bits set. It's sorted as if it were 10.0.0.0/24, but by default it's left as it is. If you pass "--host-bits error", omegasort exits with an error giving the line number of the first network with host bits set. If you pass "--host-bits warn", it prints a warning for each one. If you pass "--host-bits clear", the host bits are cleared, so 10.0.0.5/24 becomes 10.0.0.0/24 and "10.0.0.5 255.255.255.0" becomes "10.0.0.0 255.255.255.0". With --check, the file must not have any host bits set in that case.
+
+If you pass --canonicalize, host bits are cleared and IPv6 addresses are lowercased and compressed as described in RFC 5952. Ranges and masked addresses keep their notation.
+
+This sorting method accepts the --reverse, --split-ranges, --collapse, --check-overlaps, --host-bits, and --canonicalize flags. --collapse and --check-overlaps only accept a range if it is exactly one network, so use --split-ranges with them for other ranges.
+
+## IP or Network Sort
+
+This method assumes that each line is either an IPv4 or IPv6 address or a network in CIDR notation, so it works for lists which mix single hosts and networks. An address is sorted as if it were a /32 or /128 network, so 10.0.0.0/24 comes before 10.0.0.1, and 10.0.0.1 and 10.0.0.1/32 are equal. Otherwise this sorts the same way as network sort.
+
+By default each line is rewritten in its canonical form. IPv6 addresses are lowercased and compressed, as in "2001:db8::1", and host bits are cleared in networks, so 10.0.0.5/24 becomes 10.0.0.0/24. An address stays an address rather than becoming a /32 or /128 network. With --check, the file must also be in canonical form. Pass "--display original" to keep each line as it is. Passing --canonicalize is the same as the default.
+
+This sorting method accepts the --reverse and --display flags.
+
+## Hostname Sort
+
+This method assumes that each line is a hostname, like "www.example.com". Hostnames are compared label by label starting from the top-level domain, so all the names under example.com sort together, and a.example.com sorts next to b.example.com rather than next to a.example.org. A domain sorts before the names under it.
+
+Hostnames are always compared case-insensitively, and a trailing "." is ignored. Punycode labels like "xn--bcher-kva" are compared as the Unicode text they encode, so "xn--bcher-kva.de" and "bücher.de" are equal. The leftmost label can be a "*" wildcard, which sorts before any other label at the same level.
 
 This sorting method accepts the --reverse flag.
 
+## Email Sort
+
+This method assumes that each line is an email address. The line can be a bare address like "foo@example.com", or it can contain an address in angle brackets, like "Foo Bar <foo@example.com>". If there is more than one address in angle brackets, as in a .mailmap file, the first one is used. Any text outside the brackets is ignored when sorting.
+
+Addresses are sorted by domain first, using the same ordering as the hostname approach, and then by the part before the "@". Domains are always compared case-insensitively, but the part before the "@" is only compared case-insensitively if you pass --case-insensitive.
+
+This sorting method accepts the --case-insensitive and --reverse flags.
+
+## URL Sort
+
+This method assumes that each line is an absolute URL, like "https://www.example.com/a/b?x=1". URLs are compared by the following rules, in order:
+
+* The scheme, case-insensitively.
+* The host. URLs without a host come first, then URLs with an IPv4 address, then URLs with an IPv6 address, each sorted as with the ip approach, then URLs with a hostname, sorted as with the hostname approach.
+* The port, numerically. URLs without a port come before URLs with one.
+* The path, sorted as with the path approach, so shallower paths come before deeper ones.
+* The query parameters, which are sorted before they're compared, so "?a=1&b=2" and "?b=2&a=1" are equal.
+
+If you pass --normalize-urls, URLs are normalized before they're compared. Default ports like 80 for http are removed, an empty path is the same as "/", "." and ".." path segments are resolved, and percent-encoded characters in the path and query are decoded. Use this with --unique-by-key to remove URLs that are the same after normalizing them.
+
+This sorting method accepts the --case-insensitive, --reverse, and --normalize-urls flags. The --case-insensitive flag only applies to the path, since the scheme and host are always compared case-insensitively.
+
+## MAC Sort
+
+This method assumes that each line is a MAC address. Addresses can be written with colons, like "00:11:22:33:44:55", with hyphens, like "00-11-22-33-44-55", in the dotted form used by Cisco, like "0011.2233.4455", or as bare hex, like "001122334455". An EUI-64 address, which has 8 bytes instead of 6, can be written in any of these forms too. Hex digits can be upper or lower case.
+
+Addresses are sorted numerically, so the form they're written in doesn't matter. Every 6 byte address comes before every 8 byte address. With --unique, the same address written in different forms is a duplicate, and only the first one is kept.
+
+If you pass --canonicalize, each address is rewritten as lowercase hex pairs separated by colons, like "00:11:22:33:44:55".
+
+This sorting method accepts the --reverse and --canonicalize flags.
+
+## UUID Sort
+
+This method assumes that each line is a UUID, like "f81d4fae-7dec-11d0-a765-00a0c91e6bf6". UUIDs are case-insensitive, the hyphens are optional, and a UUID can be wrapped in braces, like "{f81d4fae-7dec-11d0-a765-00a0c91e6bf6}". UUIDs are sorted by their 128-bit value.
+
+If you pass --uuid-time-order, v1, v6, and v7 UUIDs are sorted by the timestamp in them instead, and they come before UUIDs of other versions, which are sorted by their value. UUIDs with the same timestamp are sorted by their value.
+
+With --unique, the same UUID written in different forms is a duplicate, and only the first one is kept. If you pass --canonicalize, each UUID is rewritten in lowercase with hyphens and without braces.
+
+This sorting method accepts the --reverse, --uuid-time-order, and --canonicalize flags.
+
+## ULID Sort
+
+This method assumes that each line is a ULID, like "01ARZ3NDEKTSV4RRFFQ69G5FAV". ULIDs are case-insensitive. They are sorted by the timestamp in them and then by their random part, which is the same as sorting them by their 128-bit value.
+
+With --unique, the same ULID written in different cases is a duplicate, and only the first one is kept. If you pass --canonicalize, each ULID is rewritten in uppercase.
+
+This sorting method accepts the --reverse and --canonicalize flags.
+
+## Multiple Keys
+
+You can sort on more than one key by passing the --key flag more than once. Each key looks like "FIELD[,APPROACH][,OPTION...]". Lines are compared by the first key, and each following key is only used to break ties in the keys before it. If all the keys are equal, lines stay in their original order.
+
+The field is a 1-based index into the whitespace-separated fields of each line. A field of 0 means the whole line. Lines which don't have the given field are treated as if that field were an empty string.
+
+The approach is any of the sorting methods listed above. If a key does not have an approach then the --sort method is used.
+
+The options are "reverse", "case-insensitive", "windows", "normalize", "ports=POLICY", "families=ORDER", "mapped-as-v4", "time-order", "month-first", "day-first", "format=FORMAT", "timezone=ZONE", and "locale=LOCALE". A key can have more than one "format" option. A key uses the --windows, --normalize-urls, --ports, --ip-families, --mapped-as-v4, --uuid-time-order, --datetime-format, --timezone, --date-order, and --locale flags for any setting that its options don't change, so "-k 2,text,case-insensitive --locale de" sorts the second field case-insensitively using German rules. Like GNU sort, the ordering flags, --reverse and --case-insensitive, only apply to keys without any options, so "-r -k 1,ip -k 2,text,locale=de" sorts the first field in reverse and the second field forward. For example:
+
+    omegasort -k 1,network -k 3,datetime-text,reverse -k 2,text,locale=de file
+
+This sorts by the network in the first field, then by the datetime in the third field from newest to oldest, then by the text in the second field using German rules.
+
+## Key Regex
+
+The --key-regex flag lets you pick out the part of each line to sort on with a regular expression. The sort key is the capture group named "key" if there is one, otherwise it is the first named capture group, otherwise it is the first capture group. If the regex has no capture groups the whole match is used. For example, this sorts log lines by their source IP:
+
+    omegasort --sort ip --key-regex 'from=(\S+)' file
+
+Lines which don't match the regex are an error by default. You can use the --key-regex-unmatched flag to put them first or last instead. Unmatched lines are kept in their original order, and they stay first or last even when sorting with --reverse.
+
+If you also pass --key flags, the regex is applied to each line first, and the key fields are taken from the text the regex captured.
+
+## Header and Footer Lines
+
+Some lines should never be sorted. The --header-lines and --footer-lines flags keep that many lines at the start and end of the file where they are. The --keep-leading flag takes a regex, and keeps every line after the header which matches it, up to the first line that doesn't. These lines are not checked by --unique.
+
+For example, this keeps a license banner made of comment lines at the top of a file:
+
+    omegasort --sort text --keep-leading '^#' file
+
+Hunspell .dic files start with a count of the words in the file. If you pass --count-line, the first line is never sorted, and it is updated to the number of items after sorting, which matters when --unique removes items. With --check, the count must match the number of items.
+
+## Comments
+
+If you pass --comment-prefix, lines which start with that prefix (after any leading whitespace) are comments. Each comment line is attached to the next line that is not a comment, and moves with it. The sort keys and --unique only look at that line, so you can sort a file of IP addresses with comments in it using the ip approach:
+
+    omegasort --sort ip --comment-prefix '#' allowlist
+
+Comments at the end of the file, with nothing after them, stay at the end. Blank lines stay where they are, along with any comments directly above a blank line, so they are never sorted as lines of their own.
+
+If you also pass --attach-blank-lines, blank lines are attached to the next line in the same way as comments. This keeps a comment separated from the line above it after sorting. The file never starts with a blank line because of this. Instead, the blank lines are swapped with those of the first line from before sorting which is still in the file.
+
+## Groups
+
+If you pass --groups, the file is split into groups of lines separated by blank lines, and each group is sorted on its own. The blank lines stay where they are. With --unique, duplicates are only removed within a group.
+
+If you also pass --comment-prefix, the comment lines at the start of each group are its heading, and they stay at the top of the group. Other comments are attached to the line after them, as usual. With --check, the error names the first group which is out of order, using its heading if it has one.
+
+## Multi-line Records
+
+By default each line of the file is sorted on its own. The --records and --record-start flags let you sort records which span several lines instead. Each record is sorted by its first line, using any approach, and moves as a unit.
+
+With --records paragraphs, records are separated by one or more blank lines. The sorted records are written with a single blank line between them. Blank lines before the first record or after the last one stay where they are.
+
+With --records indented, a line which starts at column 0 begins a new record, and indented lines continue it. This works well for multi-line log events and similar files.
+
+With --record-start, each line matching the regex begins a new record. For example, you could sort BibTeX entries with --record-start '^@'.
+
+In the last two modes, any lines before the first record stay at the top of the file. If the first record ends with a blank line, the sorted records are written with a blank line between them.
+
+The --unique flag compares whole records, not just their first lines.
+
+## Separators
+
+By default items are separated by the file's line ending, which is detected from the start of the file. The -z or --null-data flag separates items with NUL bytes instead, which is what commands like "find -print0" and "git ls-files -z" produce. This is handy with the path approach, since paths can contain newlines:
+
+    find . -print0 > files && omegasort -z --sort path files
+
+The --record-separator flag lets you use any other string. It can contain escapes, so you can pass something like '\x1e' or '\t'. The same separator is used when writing the sorted output.
+
+## CSV and TSV Files
+
+If you pass --format csv or --format tsv, the file is parsed as CSV (or tab-separated values) instead of being split into lines. Quoted fields can contain delimiters, quotes, and newlines, and a record with a newline in it is sorted as a single unit.
+
+The first record is treated as a header. It always stays at the top of the file and is never sorted.
+
+The --key flag can use a column name from the header instead of a field number, so you can write something like this:
+
+    omegasort --format csv -k hostname,text -k address,ip inventory.csv
+
+If you use --key-regex with a CSV file, the regex is applied to the column for each key rather than to the whole record.
+
+If you don't pass any --key flags, each record is sorted as if it were a single line of text with the fields separated by the delimiter. The original text of each record, including its quoting, is preserved in the output.
+
+## JSON Lines Files
+
+If you pass --format jsonl, each line of the file is a JSON value, and the field for each --key is a path into that value. A path looks like ".id", ".meta.ip", or ".tags[0]". Keys which contain a period or bracket can be quoted, as in '.["key.with.dots"]'. The path "." refers to the whole value. Paths cannot contain commas, since those separate the parts of a --key.
+
+The value at the path is sorted with the key's approach. Strings are sorted as-is, and any other value is sorted as its JSON text, so you can write something like this:
+
+    omegasort --format jsonl -k .meta.ip,ip -k .timestamp,datetime-text data.jsonl
+
+If a line doesn't have a value at a key's path, or the value is null, that's an error by default. You can use the --json-missing flag to put those lines first or last instead.
+
+## JSON Documents
+
+If you pass --format json, the file is parsed as a single JSON document. Instead of sorting lines, omegasort sorts the arrays and objects at each path given by --path. Paths work the same way as for JSON Lines, and a path can use "*" or "[*]" to match every value in an object or array. For example:
+
+    omegasort --format json --sort ip --path .allowlist config.json
+
+Array elements are sorted with the --sort approach, or with the --key flags if you give them. Each key's path is relative to the array element, so you can sort an array of objects with something like "-k .address,ip". The --unique and --unique-by-key flags remove repeated elements from each array.
+
+An object at a --path has its keys sorted with the --sort approach. If you pass --sort-keys, the keys of every object in the document are sorted.
+
+The document is written back using the indentation of its first indented line, and it keeps its trailing newline if it had one. An array or object which was on a single line, like ["a", "b"], stays on a single line, and the rest are written with one value per line. An object which has the same key more than once is an error, since only one of the values could be written back.
+
+## YAML Documents
+
+If you pass --format yaml, the file is parsed as YAML, and the sequences and mappings at each --path are sorted the same way as JSON arrays and objects. A file with more than one document has each document sorted. Keys and --unique work the same way as for JSON, with every scalar treated as a string.
+
+Only the sorted items are moved, so the rest of the file, including blank lines and the spacing of comments, stays as it was. Comment lines directly above an item move with it, as does a comment at the end of its line. Other comments and blank lines stay where they are, so a comment after the last item stays at the end. A flow sequence or mapping, like [b, a], must be on a single line to be sorted.
+
+Anchors and aliases are kept. If sorting would put an alias before its anchor, or --unique would remove an anchored value, that's an error, since the result would not be valid YAML.
+
+## TOML and INI Files
+
+If you pass --format toml or --format ini, the file is split into sections, and each section into groups of entries separated by blank lines. With --sort-keys, the entries in each group are sorted by key with the --sort approach, so blank-line grouping is kept. With --sort-sections, the sections are sorted by name. Anything before the first section header always stays at the top.
+
+Comment lines directly above an entry or section header move with it. Comments which are followed by a blank line stay where they are. In an INI file, comments can start with "#" or ";", including after a section header, and lines which are indented more than the entry above them continue its value. This means that files with indented keys, like .gitconfig, are sorted by key.
+
+In a TOML file, the --path flag picks arrays to sort, like ".exclude" or ".commands.*.include". A dotted key like "tool.include = [...]" matches the path ".tool.include". The array's elements are sorted with the --sort approach, using the unquoted value of each string. A multi-line array must have one element per line, and each element keeps its comments. The tables in a TOML array of tables, like "[[products]]", are never reordered relative to each other, and their sub-tables stay with them.
+
+## Uniqueness By Key
+
+The --unique flag compares whole lines. If you pass --unique-by-key instead, two lines are considered duplicates when all of their sort keys are equal. When sorting, the first line for each key is kept. This is most useful along with --key, for example to remove JSON Lines records with a repeated ".id".
+
+Note that whether keys are equal depends on the approach, so with --case-insensitive, "Foo" and "foo" are duplicates.
+
 `
 
 func printExtendedDocs() {
@@ -333,94 +1248,413 @@ func getWidth() int {
 
 const firstChunk = 2048
 
-func (o *omegasort) run() error {
-	p := sorters.SortParams{
-		Locale:          o.locale,
-		CaseInsensitive: o.opts.caseInsensitive,
-		Reverse:         o.opts.reverse,
+// item is a single unit of a file that is sorted. For most files this is a
+// single line.
+type item struct {
+	// text is what is written to the output, without a trailing line
+	// ending.
+	text string
+	// value is what the sort keys are taken from. It is also what is
+	// compared when checking for uniqueness, unless whole is set.
+	value string
+	// whole is set for items which are sorted on only part of their text,
+	// like multi-line records, so that uniqueness takes the whole item into
+	// account.
+	whole string
+	// fields is only set for formats where each item is split into fields,
+	// like CSV.
+	fields []string
+	// line is the 1-based line number where the item starts.
+	line int
+}
+
+func (it item) uniqueValue() string {
+	if it.whole != "" {
+		return it.whole
 	}
-	if o.opts.windows {
-		p.PathType = sorters.WindowsPaths
+	return it.value
+}
+
+// document contains the items of a file along with any lines that are not
+// sorted.
+type document struct {
+	// header contains lines which are always written before the items.
+	header []string
+	items  []item
+	// separator contains lines which are written between each item.
+	separator []string
+	// footer contains lines which are always written after the items.
+	footer []string
+	// fixed contains lines which are not sorted and stay where they are
+	// among the items, like blank lines when using --comment-prefix.
+	fixed []fixedLines
+	// groups is set when sorting with --groups. Each group is a document
+	// which is sorted on its own, and the top-level document has no items.
+	groups []*document
+	// start is the line number where a group starts.
+	start int
+	// reformatted is set when writing the document changes it even if the
+	// items are not moved, like when the blank lines between records are
+	// made the same.
+	reformatted bool
+}
+
+// fixedLines are lines which are written after a given number of items, no
+// matter how the items are sorted.
+type fixedLines struct {
+	after int
+	lines []string
+}
+
+func (d *document) addFixed(lines []string) {
+	after := len(d.items)
+	if n := len(d.fixed); n > 0 && d.fixed[n-1].after == after {
+		d.fixed[n-1].lines = append(d.fixed[n-1].lines, lines...)
+		return
 	}
+	d.fixed = append(d.fixed, fixedLines{after: after, lines: lines})
+}
 
-	lines, err := o.readLines()
+func (o *omegasort) run() error {
+	switch o.opts.format {
+	case "json":
+		return o.runJSON()
+	case "yaml":
+		return o.runYAML()
+	case "toml", "ini":
+		return o.runINI()
+	}
+
+	doc, err := o.readDocument()
 	if err != nil {
 		return err
 	}
 
-	sorter, errRef := o.sort.MakeSortFunc(&lines, p)
+	if o.opts.checkOverlaps {
+		if err := o.checkOverlaps(doc.sortable()); err != nil {
+			return err
+		}
+	}
+
+	changed := doc.reformatted
+	for _, d := range doc.sortable() {
+		c, err := o.sortItems(d)
+		if err != nil {
+			if err == errNotSorted && len(doc.groups) > 0 {
+				return groupNotSortedError{group: d.groupName()}
+			}
+			return err
+		}
+		changed = changed || c
+	}
+
+	if o.opts.countLine {
+		if o.opts.check {
+			return o.checkCount(doc)
+		}
+		countChanged, err := o.updateCount(doc)
+		if err != nil {
+			return err
+		}
+		changed = changed || countChanged
+	}
+
 	if o.opts.check {
-		ok := sort.SliceIsSorted(lines, sorter)
-		if *errRef != nil {
-			return *errRef
+		return nil
+	}
+
+	return o.writeOutput(changed, func(out io.Writer) error {
+		return o.writeDocument(out, doc)
+	})
+}
+
+// sortItems sorts the items in a document, splits ranges if --split-ranges
+// was given, removes duplicates if --unique or --unique-by-key was given, and
+// collapses networks if --collapse was given. It returns true if this changed
+// the items. In check mode it returns an error if the items are not sorted,
+// split, unique, or collapsed instead.
+func (o *omegasort) sortItems(doc *document) (bool, error) {
+	keys, err := o.sortKeys(doc.items)
+	if err != nil {
+		return false, err
+	}
+
+	if o.opts.hostBits != "allow" {
+		if err := o.handleHostBits(doc.items); err != nil {
+			return false, err
 		}
-		if !ok {
-			return errNotSorted
+	}
+
+	if o.opts.check {
+		if !keys.IsSorted() {
+			return false, errNotSorted
 		}
 
+		if o.opts.uniqueByKey {
+			if err := o.checkUniqueByKey(doc.items, keys); err != nil {
+				return false, err
+			}
+		}
 		if o.opts.unique {
-			return o.checkUnique(lines)
+			if err := o.checkUnique(doc.items); err != nil {
+				return false, err
+			}
+		}
+		if o.opts.splitRanges {
+			if err := o.checkRangesSplit(doc.items); err != nil {
+				return false, err
+			}
+		}
+		if o.opts.collapse {
+			if err := o.checkCollapsed(doc.items); err != nil {
+				return false, err
+			}
+		}
+		if o.displaysCanonical() {
+			return false, o.checkCanonical(doc.items)
 		}
 
-		return nil
+		return false, nil
 	}
 
-	origHash, err := o.hashLines(lines)
+	origHash, err := o.hashItems(doc.items)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	sort.SliceStable(lines, sorter)
-	if *errRef != nil {
-		return *errRef
+	order := keys.Order()
+	if o.opts.uniqueByKey {
+		order = o.uniquifyByKey(order, keys)
 	}
 
+	sorted := make([]item, len(order))
+	for i, idx := range order {
+		sorted[i] = doc.items[idx]
+	}
+	doc.items = sorted
+
+	if o.opts.splitRanges {
+		doc.items, err = o.splitRanges(doc.items)
+		if err != nil {
+			return false, err
+		}
+	}
+	if o.displaysCanonical() {
+		if err := o.canonicalize(doc.items); err != nil {
+			return false, err
+		}
+	}
 	if o.opts.unique {
-		lines = o.uniquify(lines)
+		doc.items = o.uniquify(doc.items)
+	}
+	if o.opts.collapse {
+		doc.items, err = o.collapse(doc.items)
+		if err != nil {
+			return false, err
+		}
+	}
+	if o.opts.attachBlank {
+		o.moveLeadingBlankLines(doc.items)
+	}
+
+	newHash, err := o.hashItems(doc.items)
+	if err != nil {
+		return false, err
+	}
+
+	return origHash != newHash, nil
+}
+
+// writeOutput calls write to write the sorted output if the file has changed
+// or if we are writing to stdout. If the file has changed and we are not
+// writing to stdout, the output replaces the original file.
+func (o *omegasort) writeOutput(changed bool, write func(io.Writer) error) error {
+	if !changed && !o.opts.toStdout {
+		return nil
+	}
+
+	out, err := o.outputFile()
+	if err != nil {
+		return err
 	}
 
-	newHash, err := o.hashLines(lines)
+	err = write(out)
 	if err != nil {
 		return err
 	}
 
-	if origHash != newHash || o.opts.toStdout {
-		out, err := o.outputFile()
+	if changed {
+		// We need to close this before we remove it on Windows. Might as well do
+		// it everywhere.
+		err = out.Close()
 		if err != nil {
 			return err
 		}
 
-		for _, l := range lines {
-			_, err = out.WriteString(l)
+		if !o.opts.toStdout {
+			err := o.updateFiles(out.Name())
 			if err != nil {
 				return err
 			}
-			_, err = out.Write(o.lineEnding)
-			if err != nil {
-				return err
+		}
+	}
+
+	return nil
+}
+
+func (o *omegasort) readDocument() (*document, error) {
+	if o.isCSV() {
+		return o.readCSV()
+	}
+
+	lines, err := o.readLines()
+	if err != nil {
+		return nil, err
+	}
+
+	header, body, footer, err := o.splitPinnedLines(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := o.readBody(body, len(header))
+	if err != nil {
+		return nil, err
+	}
+	doc.header = append(header, doc.header...)
+	doc.footer = append(doc.footer, footer...)
+
+	return doc, nil
+}
+
+// readBody turns the lines which are sorted into items. The offset is the
+// number of lines before the body, which we need to get line numbers right.
+func (o *omegasort) readBody(lines []string, offset int) (*document, error) {
+	var doc *document
+	switch {
+	case o.opts.records != "lines" || o.opts.recordStart != "":
+		var err error
+		doc, err = o.readRecords(lines)
+		if err != nil {
+			return nil, err
+		}
+	case o.opts.groups:
+		doc = o.readGroups(lines)
+	case o.opts.commentPrefix != "":
+		doc = o.attachComments(lines)
+	default:
+		doc = &document{items: make([]item, len(lines))}
+		for i, l := range lines {
+			doc.items[i] = item{
+				text:  l,
+				value: l,
+				line:  i + 1,
 			}
 		}
+	}
 
-		if origHash != newHash {
-			// We need to close this before we remove it on Windows. Might as well do
-			// it everywhere.
-			err = out.Close()
-			if err != nil {
-				return err
+	for _, d := range doc.sortable() {
+		for i := range d.items {
+			d.items[i].line += offset
+		}
+		if d.start > 0 {
+			d.start += offset
+		}
+	}
+
+	return doc, nil
+}
+
+// sortKeys parses the sort keys for each item. If an item cannot be parsed
+// the error will contain the item's line number.
+func (o *omegasort) sortKeys(items []item) (*sorters.Keys, error) {
+	values := make([]string, len(items))
+	var fields [][]string
+	for i, it := range items {
+		values[i] = it.value
+		if it.fields != nil {
+			if fields == nil {
+				fields = make([][]string, len(items))
 			}
+			fields[i] = it.fields
+		}
+	}
 
-			if !o.opts.toStdout {
-				err := o.updateFiles(out.Name())
-				if err != nil {
+	keys, err := sorters.NewSorter(o.keys...).FieldKeys(values, fields)
+	if err != nil {
+		var pe sorters.ParseError
+		if errors.As(err, &pe) {
+			pe.Index = items[pe.Index].line - 1
+			return nil, pe
+		}
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (o *omegasort) writeDocument(out io.Writer, doc *document) error {
+	for _, l := range doc.header {
+		if err := o.writeLine(out, l); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range doc.groups {
+		if err := o.writeDocument(out, g); err != nil {
+			return err
+		}
+	}
+
+	fixed := doc.fixed
+	for i, it := range doc.items {
+		if i > 0 {
+			for _, l := range doc.separator {
+				if err := o.writeLine(out, l); err != nil {
 					return err
 				}
 			}
 		}
+		for len(fixed) > 0 && fixed[0].after <= i {
+			for _, l := range fixed[0].lines {
+				if err := o.writeLine(out, l); err != nil {
+					return err
+				}
+			}
+			fixed = fixed[1:]
+		}
+		if err := o.writeLine(out, it.text); err != nil {
+			return err
+		}
+	}
+
+	// If items were removed, some fixed lines may come after the last item.
+	for _, f := range fixed {
+		for _, l := range f.lines {
+			if err := o.writeLine(out, l); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, l := range doc.footer {
+		if err := o.writeLine(out, l); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func (o *omegasort) writeLine(out io.Writer, l string) error {
+	_, err := io.WriteString(out, l)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(o.lineEnding)
+	return err
+}
+
 func (o *omegasort) readLines() ([]string, error) {
 	err := o.determineLineEnding()
 	if err != nil {
@@ -431,6 +1665,9 @@ func (o *omegasort) readLines() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	// nolint:errcheck
+	defer file.Close()
+
 	scanner := bufio.NewScanner(file)
 	scanner.Split(o.splitFunc())
 
@@ -445,11 +1682,42 @@ func (o *omegasort) readLines() ([]string, error) {
 	return lines, nil
 }
 
-var crlf = []byte{'\r', 'n'}
+var crlf = []byte{'\r', '\n'}
 var cr = []byte{'\r'}
 var nl = []byte{'\n'}
 
+func (o *omegasort) setSeparator() error {
+	if !o.opts.nullData && o.opts.recordSep == "" {
+		return nil
+	}
+
+	if o.opts.nullData && o.opts.recordSep != "" {
+		return errors.New("you cannot set both --null-data and --record-separator")
+	}
+	if o.opts.format != "lines" && o.opts.format != "jsonl" {
+		return fmt.Errorf("you cannot use --null-data or --record-separator with --format %s", o.opts.format)
+	}
+
+	if o.opts.nullData {
+		o.separator = []byte{0}
+		return nil
+	}
+
+	sep, err := strconv.Unquote(`"` + strings.ReplaceAll(o.opts.recordSep, `"`, `\"`) + `"`)
+	if err != nil {
+		return fmt.Errorf("the --record-separator %q contains an invalid escape", o.opts.recordSep)
+	}
+	o.separator = []byte(sep)
+
+	return nil
+}
+
 func (o *omegasort) determineLineEnding() error {
+	if o.separator != nil {
+		o.lineEnding = o.separator
+		return nil
+	}
+
 	file, err := os.Open(o.opts.file)
 	if err != nil {
 		return err
@@ -501,48 +1769,105 @@ func (o *omegasort) splitFunc() bufio.SplitFunc {
 }
 
 type notUniqueError struct {
-	line    int
-	content string
+	line int
+	// location is used instead of the line number when it is set.
+	location string
+	content  string
 }
 
 func (nue notUniqueError) Error() string {
-	return fmt.Sprintf("line %d is a repeat - %s", nue.line, nue.content)
+	loc := nue.location
+	if loc == "" {
+		loc = fmt.Sprintf("line %d", nue.line)
+	}
+	return fmt.Sprintf("%s is a repeat - %s", loc, nue.content)
 }
 
-func (o *omegasort) checkUnique(lines []string) error {
-	seen := make(map[string]bool, len(lines))
-	for i, l := range lines {
-		if seen[l] {
+func (o *omegasort) checkUnique(items []item) error {
+	seen := make(map[string]bool, len(items))
+	for _, it := range items {
+		if seen[o.uniqueValue(it)] {
 			return notUniqueError{
-				line:    i + 1,
-				content: l,
+				line:    it.line,
+				content: it.text,
 			}
 		}
-		seen[l] = true
+		seen[o.uniqueValue(it)] = true
 	}
 
 	return nil
 }
 
-func (o *omegasort) uniquify(lines []string) []string {
-	seen := make(map[string]bool, len(lines))
-	uniq := make([]string, 0, len(lines))
+func (o *omegasort) uniquify(items []item) []item {
+	seen := make(map[string]bool, len(items))
+	uniq := make([]item, 0, len(items))
 
-	for _, l := range lines {
-		if seen[l] {
+	for _, it := range items {
+		if seen[o.uniqueValue(it)] {
 			continue
 		}
-		uniq = append(uniq, l)
-		seen[l] = true
+		uniq = append(uniq, it)
+		seen[o.uniqueValue(it)] = true
 	}
 
 	return uniq
 }
 
-func (o *omegasort) hashLines(lines []string) (string, error) {
+// uniqueValue returns the value that --unique compares. With --mapped-as-v4,
+// an IPv4-mapped address is the same as the IPv4 address it maps to. MAC
+// addresses, UUIDs, and ULIDs are compared in their canonical form, so the
+// same value written in different forms is a duplicate.
+func (o *omegasort) uniqueValue(it item) string {
+	if o.wholeLineIsValue() {
+		switch o.opts.sort {
+		case "ip":
+			if v, ok := sorters.UnmapIPv4(it.value); ok && o.opts.mappedAsV4 {
+				return v
+			}
+		case "mac", "uuid", "ulid":
+			if v, err := o.sort.Canonicalize(it.value); err == nil {
+				return v
+			}
+		}
+	}
+	return it.uniqueValue()
+}
+
+// checkUniqueByKey checks that no two adjacent items have the same sort keys.
+// This should only be called once we know that the items are sorted, since
+// that means that any duplicates will be next to each other.
+func (o *omegasort) checkUniqueByKey(items []item, keys *sorters.Keys) error {
+	for i := 1; i < len(items); i++ {
+		if keys.Compare(i-1, i) == 0 {
+			return notUniqueError{
+				line:    items[i].line,
+				content: items[i].text,
+			}
+		}
+	}
+
+	return nil
+}
+
+// uniquifyByKey takes the sorted order of the items and removes any item
+// whose sort keys are the same as the item before it. The first item with a
+// given key is kept.
+func (o *omegasort) uniquifyByKey(order []int, keys *sorters.Keys) []int {
+	uniq := make([]int, 0, len(order))
+	for _, idx := range order {
+		if len(uniq) > 0 && keys.Compare(uniq[len(uniq)-1], idx) == 0 {
+			continue
+		}
+		uniq = append(uniq, idx)
+	}
+
+	return uniq
+}
+
+func (o *omegasort) hashItems(items []item) (string, error) {
 	h := md5.New()
-	for _, l := range lines {
-		_, err := h.Write([]byte(l))
+	for _, it := range items {
+		_, err := h.Write([]byte(it.text))
 		if err != nil {
 			return "", err
 		}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/houseabsolute/omegasort/internal/ip"
+)
+
+type notCollapsedError struct {
+	line    int
+	content string
+}
+
+func (nce notCollapsedError) Error() string {
+	return fmt.Sprintf("line %d - %s can be merged with or is covered by another network", nce.line, nce.content)
+}
+
+type hostBitsError struct {
+	line    int
+	content string
+	network string
+}
+
+func (hbe hostBitsError) Error() string {
+	return fmt.Sprintf("line %d - %s has host bits set, so it is the same as %s", hbe.line, hbe.content, hbe.network)
+}
+
+// handleHostBits looks for networks with host bits set, like 10.0.0.5/24,
+// and handles them according to --host-bits. With "error" it returns an
+// error for the first one, with "warn" it prints a warning for each one, and
+// with "clear" it clears the host bits. In check mode, "clear" returns an
+// error instead, since the file would be changed.
+func (o *omegasort) handleHostBits(items []item) error {
+	for i, it := range items {
+		cleared, err := clearHostBits(it.value)
+		if err != nil {
+			return fmt.Errorf("invalid network '%s' at line %d", it.value, it.line)
+		}
+		if cleared == it.value {
+			continue
+		}
+
+		hbErr := hostBitsError{line: it.line, content: it.value, network: cleared}
+		switch o.opts.hostBits {
+		case "error":
+			return hbErr
+		case "warn":
+			_, err := os.Stderr.WriteString(fmt.Sprintf("Warning: the %s file has host bits set: %s\n", o.opts.file, hbErr))
+			if err != nil {
+				return err
+			}
+		case "clear":
+			if o.opts.check {
+				return notCanonicalError{line: it.line, content: it.value, canonical: cleared}
+			}
+			items[i].text = strings.TrimSuffix(it.text, it.value) + cleared
+			items[i].value = cleared
+		}
+	}
+
+	return nil
+}
+
+// clearHostBits returns a network with its host bits cleared. Only the
+// address is changed, so the network keeps its notation. Ranges don't have
+// host bits, so they're returned as-is.
+func clearHostBits(v string) (string, error) {
+	r, err := ip.ParseRange(v)
+	if err != nil {
+		return "", err
+	}
+
+	var addr string
+	switch {
+	case strings.Contains(v, "/"):
+		addr = strings.TrimSpace(v[:strings.Index(v, "/")])
+	case strings.Contains(v, "-"):
+		return v, nil
+	default:
+		addr = strings.Fields(v)[0]
+	}
+
+	if ip.FromString(addr) == r.Start() {
+		return v, nil
+	}
+	return strings.Replace(v, addr, r.Start().String(), 1), nil
+}
+
+// collapse replaces the networks in the items with the smallest list of
+// networks which covers the same addresses. An item whose network is in that
+// list is kept as-is, so its text doesn't change. New items are made for the
+// networks created by merging, and these use the line number of the first
+// item they replace.
+func (o *omegasort) collapse(items []item) ([]item, error) {
+	cidrs, err := parseNetworks(items)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return ip.Compare(cidrs[order[i]], cidrs[order[j]]) < 0
+	})
+
+	// Both the collapsed networks and the order are sorted, so the items
+	// covered by each collapsed network come right after the items covered
+	// by the one before it.
+	collapsed := ip.Collapse(cidrs)
+	result := make([]item, 0, len(collapsed))
+	next := 0
+	for _, c := range collapsed {
+		first, kept := order[next], -1
+		for next < len(order) && ip.Contains(c, cidrs[order[next]]) {
+			if kept < 0 && cidrs[order[next]] == c {
+				kept = order[next]
+			}
+			next++
+		}
+
+		if kept >= 0 {
+			result = append(result, items[kept])
+			continue
+		}
+		result = append(result, item{
+			text:  c.String(),
+			value: c.String(),
+			line:  items[first].line,
+		})
+	}
+
+	if o.opts.reverse {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+
+	return result, nil
+}
+
+// checkCollapsed returns an error for the first item which would be removed
+// or merged by collapse.
+func (o *omegasort) checkCollapsed(items []item) error {
+	cidrs, err := parseNetworks(items)
+	if err != nil {
+		return err
+	}
+
+	keep := map[ip.CIDR]bool{}
+	for _, c := range ip.Collapse(cidrs) {
+		keep[c] = true
+	}
+
+	for i, c := range cidrs {
+		if !keep[c] {
+			return notCollapsedError{line: items[i].line, content: items[i].text}
+		}
+		// If a network is repeated, only its first appearance is kept.
+		delete(keep, c)
+	}
+
+	return nil
+}
+
+// parseNetworks parses the network in each item. A range or masked address
+// is allowed if it's exactly one network. Otherwise it has to be split with
+// --split-ranges first.
+func parseNetworks(items []item) ([]ip.CIDR, error) {
+	cidrs := make([]ip.CIDR, len(items))
+	for i, it := range items {
+		r, err := ip.ParseRange(it.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s' at line %d", it.value, it.line)
+		}
+		c, ok := r.CIDR()
+		if !ok {
+			return nil, fmt.Errorf(
+				"the range '%s' at line %d is not a single network, so you must also pass --split-ranges",
+				it.value, it.line,
+			)
+		}
+		cidrs[i] = c
+	}
+
+	return cidrs, nil
+}
+
+// splitRanges replaces each item that is a range or an address with a mask
+// with one item for each network in the range. Items in CIDR form are kept
+// as-is. The new items are in the same order as the ranges, so a sorted
+// list stays sorted.
+func (o *omegasort) splitRanges(items []item) ([]item, error) {
+	var result []item
+	for _, it := range items {
+		cidrs, err := rangeCIDRs(it)
+		if err != nil {
+			return nil, err
+		}
+		if cidrs == nil {
+			result = append(result, it)
+			continue
+		}
+
+		if o.opts.reverse {
+			for i, j := 0, len(cidrs)-1; i < j; i, j = i+1, j-1 {
+				cidrs[i], cidrs[j] = cidrs[j], cidrs[i]
+			}
+		}
+		for _, c := range cidrs {
+			result = append(result, item{
+				text:  c.String(),
+				value: c.String(),
+				line:  it.line,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// checkRangesSplit returns an error for the first item which is not in CIDR
+// form.
+func (o *omegasort) checkRangesSplit(items []item) error {
+	for _, it := range items {
+		cidrs, err := rangeCIDRs(it)
+		if err != nil {
+			return err
+		}
+		if cidrs != nil {
+			var split []string
+			for _, c := range cidrs {
+				split = append(split, c.String())
+			}
+			return notCanonicalError{line: it.line, content: it.value, canonical: strings.Join(split, ", ")}
+		}
+	}
+
+	return nil
+}
+
+// rangeCIDRs returns the networks for an item which is not in CIDR form, or
+// nil if it is.
+func rangeCIDRs(it item) ([]ip.CIDR, error) {
+	if strings.Contains(it.value, "/") {
+		return nil, nil
+	}
+
+	r, err := ip.ParseRange(it.value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network '%s' at line %d", it.value, it.line)
+	}
+	return r.CIDRs(), nil
+}
+
+type overlapError struct {
+	pairs []string
+}
+
+func (oe overlapError) Error() string {
+	return strings.Join(oe.pairs, "\n")
+}
+
+// checkOverlaps returns an error listing every pair of networks in the file
+// where one network contains the other. This looks at the items in every
+// group together, since an overlap is a mistake even when the networks are
+// in different groups.
+//
+// This runs before the ranges are split, so with --split-ranges we check
+// each of the networks in a range. A range is reported once for each item it
+// overlaps, even if more than one of its networks overlaps that item.
+func (o *omegasort) checkOverlaps(docs []*document) error {
+	var items []item
+	for _, d := range docs {
+		items = append(items, d.items...)
+	}
+
+	var cidrs []ip.CIDR
+	var owners []item
+	if o.opts.splitRanges {
+		for _, it := range items {
+			split, err := rangeCIDRs(it)
+			if err != nil {
+				return err
+			}
+			if split == nil {
+				c, err := parseNetworks([]item{it})
+				if err != nil {
+					return err
+				}
+				split = c
+			}
+			for _, c := range split {
+				cidrs = append(cidrs, c)
+				owners = append(owners, it)
+			}
+		}
+	} else {
+		var err error
+		cidrs, err = parseNetworks(items)
+		if err != nil {
+			return err
+		}
+		owners = items
+	}
+
+	var pairs []string
+	seen := map[string]bool{}
+	for _, p := range ip.Overlaps(cidrs) {
+		outer, inner := owners[p[0]], owners[p[1]]
+		verb := "contains"
+		if cidrs[p[0]] == cidrs[p[1]] {
+			verb = "is the same network as"
+		}
+		pair := fmt.Sprintf("line %d - %s %s line %d - %s", outer.line, outer.text, verb, inner.line, inner.text)
+		if seen[pair] {
+			continue
+		}
+		seen[pair] = true
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) > 0 {
+		return overlapError{pairs}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// readRecords groups the lines of a file into multi-line records, based on
+// the --records or --record-start flag. Each record is sorted by its first
+// line, but the whole record is compared when checking for uniqueness.
+//
+// Any lines before the first record are put in the document's header, so
+// they stay at the top of the file, and any blank lines after the last
+// record are put in its footer.
+func (o *omegasort) readRecords(lines []string) (*document, error) {
+	startsRecord, err := o.recordStartFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &document{}
+	var records [][]string
+	var starts []int
+	afterBlank := true
+	for i, l := range lines {
+		var isStart bool
+		if o.opts.records == "paragraphs" {
+			// Blank lines are never the start of a paragraph. They are
+			// stripped from the end of each paragraph below.
+			blank := strings.TrimSpace(l) == ""
+			isStart, afterBlank = afterBlank && !blank, blank
+		} else {
+			isStart = startsRecord(l)
+		}
+
+		switch {
+		case isStart:
+			records = append(records, []string{l})
+			starts = append(starts, i+1)
+		case len(records) == 0:
+			doc.header = append(doc.header, l)
+		default:
+			records[len(records)-1] = append(records[len(records)-1], l)
+		}
+	}
+
+	// We strip the trailing blank lines from every record so that a record
+	// keeps the same separator after it moves. Records are separated by a
+	// blank line if the first record that has another record after it ends
+	// with one. If any other record is followed by a different number of
+	// blank lines, writing the file changes it even if the records don't
+	// move.
+	for i, r := range records {
+		end := len(r)
+		for end > 1 && strings.TrimSpace(r[end-1]) == "" {
+			end--
+		}
+		if i == 0 && len(records) > 1 && (end < len(r) || o.opts.records == "paragraphs") {
+			doc.separator = []string{""}
+		}
+		if i == len(records)-1 {
+			doc.footer = r[end:]
+		} else if len(r)-end != len(doc.separator) {
+			doc.reformatted = true
+		}
+		records[i] = r[:end]
+	}
+
+	le := string(o.lineEnding)
+	doc.items = make([]item, len(records))
+	for i, r := range records {
+		text := strings.Join(r, le)
+		doc.items[i] = item{
+			text:  text,
+			value: r[0],
+			whole: text,
+			line:  starts[i],
+		}
+	}
+
+	return doc, nil
+}
+
+// recordStartFunc returns a function which decides whether a line starts a
+// new record. This is not used in paragraph mode, where a record starts
+// after one or more blank lines.
+func (o *omegasort) recordStartFunc() (func(string) bool, error) {
+	if o.opts.recordStart != "" {
+		re, err := regexp.Compile(o.opts.recordStart)
+		if err != nil {
+			return nil, fmt.Errorf("the --record-start regex is invalid: %w", err)
+		}
+		return re.MatchString, nil
+	}
+
+	// In indented mode, a line that starts at column 0 begins a new record,
+	// and indented or blank lines continue it.
+	return func(l string) bool {
+		return l != "" && l[0] != ' ' && l[0] != '\t'
+	}, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/houseabsolute/omegasort/internal/jsonpath"
+	"github.com/houseabsolute/omegasort/internal/sorters"
+)
+
+// The functions in this file are shared by the formats which sort the
+// arrays and objects inside a structured document, rather than sorting the
+// lines of a file.
+
+// isStructured returns true for the formats which sort values inside a
+// document rather than sorting the lines of a file.
+func (o *omegasort) isStructured() bool {
+	switch o.opts.format {
+	case "json", "yaml", "toml", "ini":
+		return true
+	}
+	return false
+}
+
+func (o *omegasort) validateStructuredArgs() error {
+	isINI := o.opts.format == "toml" || o.opts.format == "ini"
+
+	if !o.isStructured() {
+		if len(o.opts.paths) > 0 || o.opts.sortAllKeys || o.opts.sortSections {
+			return fmt.Errorf("you cannot use --path, --sort-keys, or --sort-sections with --format %s", o.opts.format)
+		}
+		return nil
+	}
+
+	if len(o.opts.paths) == 0 && !o.opts.sortAllKeys && !o.opts.sortSections {
+		if isINI {
+			return fmt.Errorf("you must pass --path, --sort-keys, or --sort-sections with --format %s", o.opts.format)
+		}
+		return fmt.Errorf("you must pass --path or --sort-keys with --format %s", o.opts.format)
+	}
+
+	if o.opts.sortSections && !isINI {
+		return fmt.Errorf("you cannot use --sort-sections with --format %s", o.opts.format)
+	}
+
+	if len(o.opts.paths) > 0 && o.opts.format == "ini" {
+		return errors.New("you cannot use --path with --format ini, since INI files do not have arrays")
+	}
+
+	return nil
+}
+
+// keysArePaths returns true when the field for each --key is a path into a
+// JSON value rather than a field number or column name.
+func (o *omegasort) keysArePaths() bool {
+	return o.opts.format == "jsonl" || o.isStructured()
+}
+
+// sortKeyNames returns the order that the keys of an object should be in,
+// using the --sort approach. Object keys are always unique so we don't need
+// to check for that. In check mode this returns errNotSorted if the keys are
+// not sorted, and otherwise it returns a nil order.
+func (o *omegasort) sortKeyNames(names []string) ([]int, error) {
+	if o.opts.sort == "" {
+		return nil, errors.New("you must set a --sort method to sort the keys of an object")
+	}
+
+	sorter := sorters.NewSorter(sorters.Key{
+		Approach: o.sort,
+		Params:   o.sortParams(),
+	})
+	keys, err := sorter.Keys(names)
+	if err != nil {
+		var pe sorters.ParseError
+		if errors.As(err, &pe) {
+			return nil, fmt.Errorf("%s in the key %q", pe.Err, names[pe.Index])
+		}
+		return nil, err
+	}
+
+	if o.opts.check {
+		if !keys.IsSorted() {
+			return nil, errNotSorted
+		}
+		return nil, nil
+	}
+
+	return keys.Order(), nil
+}
+
+// sortElements returns the order that the elements of an array should be
+// in, with any duplicates removed if --unique or --unique-by-key was given.
+// Each value is the JSON text of an element, so each key's path is relative
+// to the element.
+//
+// In check mode this returns errNotSorted or a notUniqueError if there is a
+// problem, and otherwise it returns a nil order.
+func (o *omegasort) sortElements(path jsonpath.Path, values []string) ([]int, error) {
+	keys, err := sorters.NewSorter(o.keys...).Keys(values)
+	if err != nil {
+		var pe sorters.ParseError
+		if errors.As(err, &pe) {
+			return nil, fmt.Errorf("%s at element %d of %s", pe.Err, pe.Index, path)
+		}
+		return nil, err
+	}
+
+	if o.opts.check {
+		if !keys.IsSorted() {
+			return nil, errNotSorted
+		}
+		return nil, o.checkElementsUnique(path, values, keys)
+	}
+
+	order := keys.Order()
+	if o.opts.uniqueByKey {
+		order = o.uniquifyByKey(order, keys)
+	}
+	if !o.opts.unique {
+		return order, nil
+	}
+
+	uniq := make([]int, 0, len(order))
+	seen := map[string]bool{}
+	for _, idx := range order {
+		if seen[values[idx]] {
+			continue
+		}
+		seen[values[idx]] = true
+		uniq = append(uniq, idx)
+	}
+
+	return uniq, nil
+}
+
+func (o *omegasort) checkElementsUnique(path jsonpath.Path, values []string, keys *sorters.Keys) error {
+	seen := map[string]bool{}
+	for i, v := range values {
+		dupe := false
+		switch {
+		case o.opts.uniqueByKey:
+			dupe = i > 0 && keys.Compare(i-1, i) == 0
+		case o.opts.unique:
+			dupe = seen[v]
+			seen[v] = true
+		}
+
+		if dupe {
+			return notUniqueError{
+				location: fmt.Sprintf("element %d of %s", i, path),
+				content:  v,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/houseabsolute/omegasort/internal/jsonpath"
+	"gopkg.in/yaml.v3"
+)
+
+// runYAML sorts a YAML file, which may contain more than one document. This
+// works like runJSON, except that we work with the yaml.Node tree so that
+// comments and anchors are kept. The sorted file is made by moving the lines
+// of the original file around, so that the rest of the file is unchanged.
+func (o *omegasort) runYAML() error {
+	content, err := ioutil.ReadFile(o.opts.file)
+	if err != nil {
+		return err
+	}
+
+	docs, err := decodeYAML(content)
+	if err != nil {
+		return fmt.Errorf("could not parse the file as YAML: %w", err)
+	}
+
+	splicer := newYAMLSplicer(content, docs)
+	for _, doc := range docs {
+		if err := o.sortYAML(doc); err != nil {
+			return err
+		}
+	}
+
+	if o.opts.check {
+		return nil
+	}
+
+	for _, doc := range docs {
+		if err := checkYAMLAliases(doc, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+
+	after, err := splicer.splice(docs)
+	if err != nil {
+		return err
+	}
+	if err := checkYAMLSplice(after, docs); err != nil {
+		return err
+	}
+
+	return o.writeOutput(!bytes.Equal(content, after), func(out io.Writer) error {
+		_, err := out.Write(after)
+		return err
+	})
+}
+
+func decodeYAML(content []byte) ([]*yaml.Node, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+
+	var docs []*yaml.Node
+	for {
+		doc := &yaml.Node{}
+		err := dec.Decode(doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func encodeYAML(docs []*yaml.Node) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkYAMLSplice makes sure that the spliced file has the same values as
+// the sorted documents, ignoring comments. If it doesn't, we return an error
+// rather than writing a file which was changed in some other way.
+func checkYAMLSplice(spliced []byte, docs []*yaml.Node) error {
+	got, err := decodeYAML(spliced)
+	if err == nil {
+		var want, have []byte
+		if want, err = encodeYAML(stripYAMLComments(docs)); err != nil {
+			return err
+		}
+		if have, err = encodeYAML(stripYAMLComments(got)); err != nil {
+			return err
+		}
+		if bytes.Equal(want, have) {
+			return nil
+		}
+	}
+
+	return errors.New("could not sort the file without changing more than the order of its items")
+}
+
+func stripYAMLComments(nodes []*yaml.Node) []*yaml.Node {
+	for _, n := range nodes {
+		n.HeadComment = ""
+		n.LineComment = ""
+		n.FootComment = ""
+		stripYAMLComments(n.Content)
+	}
+	return nodes
+}
+
+func (o *omegasort) sortYAML(doc *yaml.Node) error {
+	if o.opts.sortAllKeys {
+		if err := o.sortAllYAMLKeys(doc); err != nil {
+			return err
+		}
+	}
+
+	for _, expr := range o.opts.paths {
+		path, err := jsonpath.Parse(expr)
+		if err != nil {
+			return err
+		}
+
+		found := selectYAML(doc, path.Segments())
+		if len(found) == 0 {
+			return fmt.Errorf("there is no value at %s", path)
+		}
+
+		for _, n := range found {
+			switch n.Kind {
+			case yaml.SequenceNode:
+				err = o.sortYAMLSequence(path, n)
+			case yaml.MappingNode:
+				err = o.sortYAMLKeys(n)
+			default:
+				err = fmt.Errorf("the value at %s is not a sequence or mapping", path)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// selectYAML returns every node that matches the path segments. Aliases are
+// followed, so sorting the value at an alias sorts the anchored value.
+func selectYAML(n *yaml.Node, segments []jsonpath.Segment) []*yaml.Node {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return selectYAML(n.Content[0], segments)
+	case yaml.AliasNode:
+		return selectYAML(n.Alias, segments)
+	}
+
+	if len(segments) == 0 {
+		return []*yaml.Node{n}
+	}
+
+	seg := segments[0]
+	var found []*yaml.Node
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			if seg.IsWildcard || (seg.IsIndex && seg.Index == i) {
+				found = append(found, selectYAML(c, segments[1:])...)
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			if !seg.IsIndex && (seg.IsWildcard || n.Content[i].Value == seg.Key) {
+				found = append(found, selectYAML(n.Content[i+1], segments[1:])...)
+			}
+		}
+	}
+
+	return found
+}
+
+func (o *omegasort) sortAllYAMLKeys(n *yaml.Node) error {
+	if n.Kind == yaml.MappingNode {
+		if err := o.sortYAMLKeys(n); err != nil {
+			return err
+		}
+	}
+
+	// We don't follow aliases here, since the anchored node is sorted when
+	// we reach it.
+	for _, c := range n.Content {
+		if err := o.sortAllYAMLKeys(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortYAMLKeys sorts a mapping's keys with the --sort approach. The content
+// of a mapping node alternates between keys and values, so we move each
+// key and value as a pair.
+func (o *omegasort) sortYAMLKeys(n *yaml.Node) error {
+	names := make([]string, 0, len(n.Content)/2)
+	for i := 0; i < len(n.Content); i += 2 {
+		names = append(names, n.Content[i].Value)
+	}
+
+	order, err := o.sortKeyNames(names)
+	if err != nil || order == nil {
+		return err
+	}
+
+	sorted := make([]*yaml.Node, 0, len(n.Content))
+	for _, idx := range order {
+		sorted = append(sorted, n.Content[idx*2], n.Content[idx*2+1])
+	}
+	n.Content = sorted
+
+	return nil
+}
+
+func (o *omegasort) sortYAMLSequence(path jsonpath.Path, n *yaml.Node) error {
+	values := make([]string, len(n.Content))
+	for i, c := range n.Content {
+		b, err := json.Marshal(yamlValue(c))
+		if err != nil {
+			return err
+		}
+		values[i] = string(b)
+	}
+
+	order, err := o.sortElements(path, values)
+	if err != nil || order == nil {
+		return err
+	}
+
+	sorted := make([]*yaml.Node, len(order))
+	for i, idx := range order {
+		sorted[i] = n.Content[idx]
+	}
+	n.Content = sorted
+
+	return nil
+}
+
+// yamlValue turns a node into a value that can be encoded as JSON, so that
+// --key paths work the same way as they do for JSON. Scalars are always
+// strings, using the text as it appears in the file.
+func yamlValue(n *yaml.Node) interface{} {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.SequenceNode:
+		arr := make([]interface{}, len(n.Content))
+		for i, c := range n.Content {
+			arr[i] = yamlValue(c)
+		}
+		return arr
+	case yaml.MappingNode:
+		obj := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i < len(n.Content); i += 2 {
+			obj[n.Content[i].Value] = yamlValue(n.Content[i+1])
+		}
+		return obj
+	}
+
+	if n.Tag == "!!null" {
+		return nil
+	}
+	return n.Value
+}
+
+// checkYAMLAliases makes sure that every alias still comes after its anchor
+// once the document has been sorted. A YAML document where an alias comes
+// first cannot be parsed.
+func checkYAMLAliases(n *yaml.Node, anchors map[string]bool) error {
+	if n.Kind == yaml.AliasNode {
+		if !anchors[n.Value] {
+			return fmt.Errorf("sorting would put the alias *%s before its anchor, or remove the anchored value", n.Value)
+		}
+		return nil
+	}
+
+	if n.Anchor != "" {
+		anchors[n.Anchor] = true
+	}
+	for _, c := range n.Content {
+		if err := checkYAMLAliases(c, anchors); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// yamlSplicer makes the sorted file by moving the lines of the original file
+// around. Only the sorted items move, so blank lines, the spacing of
+// comments, and everything else in the file are kept.
+type yamlSplicer struct {
+	lines []string
+	// original contains the content of each sequence and mapping before it
+	// was sorted.
+	original map[*yaml.Node][]*yaml.Node
+	// blocks contains the sorted block collections, keyed by the index of
+	// the first line of their first item.
+	blocks map[int][]*yamlBlock
+	// flows contains the sorted flow collections, keyed by the index of the
+	// line they're on.
+	flows map[int][]*yaml.Node
+	// open contains the blocks whose items are being written.
+	open map[*yaml.Node]bool
+}
+
+// yamlBlock is a sorted block sequence or mapping.
+type yamlBlock struct {
+	node *yaml.Node
+	// indent is the column of the "-" for each item in a sequence, or of
+	// each key in a mapping, counting from 0.
+	indent int
+	// items contains the lines of each item in their original order. Any
+	// comment lines directly above an item are part of it. The lines between
+	// items stay where they are.
+	items []yamlLines
+	// index maps each item, or each key for a mapping, to its lines.
+	index map[*yaml.Node]int
+}
+
+type yamlLines struct {
+	start, end int
+}
+
+func newYAMLSplicer(content []byte, docs []*yaml.Node) *yamlSplicer {
+	s := &yamlSplicer{
+		lines:    strings.Split(string(content), "\n"),
+		original: map[*yaml.Node][]*yaml.Node{},
+		blocks:   map[int][]*yamlBlock{},
+		flows:    map[int][]*yaml.Node{},
+		open:     map[*yaml.Node]bool{},
+	}
+	s.saveOriginal(docs)
+
+	return s
+}
+
+func (s *yamlSplicer) saveOriginal(nodes []*yaml.Node) {
+	for _, n := range nodes {
+		if n.Kind == yaml.SequenceNode || n.Kind == yaml.MappingNode {
+			s.original[n] = append([]*yaml.Node(nil), n.Content...)
+		}
+		s.saveOriginal(n.Content)
+	}
+}
+
+func (s *yamlSplicer) splice(docs []*yaml.Node) ([]byte, error) {
+	if err := s.findSorted(docs); err != nil {
+		return nil, err
+	}
+
+	lines, err := s.render(0, len(s.lines)-1)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// findSorted finds the collections whose items were moved or removed.
+func (s *yamlSplicer) findSorted(nodes []*yaml.Node) error {
+	for _, n := range nodes {
+		if orig, ok := s.original[n]; ok && !sameYAMLNodes(orig, n.Content) {
+			if n.Style&yaml.FlowStyle != 0 {
+				s.flows[n.Line-1] = append(s.flows[n.Line-1], n)
+			} else {
+				b, err := s.newBlock(n)
+				if err != nil {
+					return err
+				}
+				start := b.items[0].start
+				s.blocks[start] = append(s.blocks[start], b)
+			}
+		}
+		if err := s.findSorted(n.Content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameYAMLNodes(a, b []*yaml.Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlItems returns the items of a sequence or the keys of a mapping.
+func yamlItems(kind yaml.Kind, content []*yaml.Node) []*yaml.Node {
+	if kind == yaml.SequenceNode {
+		return content
+	}
+
+	keys := make([]*yaml.Node, 0, len(content)/2)
+	for i := 0; i < len(content); i += 2 {
+		keys = append(keys, content[i])
+	}
+	return keys
+}
+
+func yamlKind(n *yaml.Node) string {
+	if n.Kind == yaml.SequenceNode {
+		return "sequence"
+	}
+	return "mapping"
+}
+
+func (s *yamlSplicer) newBlock(n *yaml.Node) (*yamlBlock, error) {
+	b := &yamlBlock{
+		node:   n,
+		indent: n.Column - 1,
+		index:  map[*yaml.Node]int{},
+	}
+
+	var firsts []int
+	for i, item := range yamlItems(n.Kind, s.original[n]) {
+		first, ok := s.itemLine(b, item)
+		if !ok || (i > 0 && first <= firsts[i-1]) {
+			return nil, fmt.Errorf("could not find the lines of each item in the %s at line %d", yamlKind(n), n.Line)
+		}
+		b.index[item] = i
+		firsts = append(firsts, first)
+	}
+
+	for _, first := range firsts {
+		b.items = append(b.items, yamlLines{start: s.itemStart(b, first)})
+	}
+	for i := range b.items {
+		limit := len(s.lines)
+		if i < len(b.items)-1 {
+			limit = b.items[i+1].start
+		}
+		b.items[i].end = s.itemEnd(b, firsts[i], limit)
+	}
+
+	return b, nil
+}
+
+// itemLine returns the index of the line with the "-" for a sequence item,
+// or with the key for a mapping. The text before the item may only be
+// indentation, or the "-" of the sequence item the collection is in.
+func (s *yamlSplicer) itemLine(b *yamlBlock, item *yaml.Node) (int, bool) {
+	for i := item.Line - 1; i >= 0; i-- {
+		l := s.lines[i]
+		if len(l) <= b.indent || strings.Trim(l[:b.indent], " -") != "" {
+			return 0, false
+		}
+		if b.node.Kind == yaml.MappingNode {
+			return i, item.Column-1 == b.indent
+		}
+		if l[b.indent] == '-' {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// itemStart returns the index of the first comment line directly above an
+// item at the same indentation, or of the item's own line if there are none.
+func (s *yamlSplicer) itemStart(b *yamlBlock, first int) int {
+	if strings.TrimLeft(s.lines[first][:b.indent], " ") != "" {
+		return first
+	}
+
+	start := first
+	for start > 0 {
+		l := s.lines[start-1]
+		trimmed := strings.TrimLeft(l, " ")
+		if !strings.HasPrefix(trimmed, "#") || len(l)-len(trimmed) != b.indent {
+			break
+		}
+		start--
+	}
+
+	return start
+}
+
+// itemEnd returns the index of the last line of an item, which is the last
+// line before the limit that is indented more than the item. Blank lines and
+// comments that are not indented more than the item are only part of it if
+// more of the item comes after them. A mapping's value may also be a
+// sequence with its "-" at the same indentation as the keys.
+func (s *yamlSplicer) itemEnd(b *yamlBlock, first, limit int) int {
+	end := first
+	for i := first + 1; i < limit; i++ {
+		trimmed := strings.TrimLeft(s.lines[i], " ")
+		indent := len(s.lines[i]) - len(trimmed)
+		switch {
+		case strings.TrimSpace(trimmed) == "":
+		case indent > b.indent:
+			end = i
+		case strings.HasPrefix(trimmed, "#"):
+		case b.node.Kind == yaml.MappingNode && indent == b.indent && isYAMLDash(trimmed):
+			end = i
+		default:
+			return end
+		}
+	}
+
+	return end
+}
+
+func isYAMLDash(trimmed string) bool {
+	return trimmed == "-" || strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "-\r")
+}
+
+// render returns the lines from index from to index to, with the items of
+// each sorted collection in those lines in their new order.
+func (s *yamlSplicer) render(from, to int) ([]string, error) {
+	var lines []string
+	for i := from; i <= to; i++ {
+		if b := s.blockAt(i); b != nil {
+			block, err := s.renderBlock(b)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, block...)
+			i = b.items[len(b.items)-1].end
+			continue
+		}
+
+		l, err := s.renderFlows(i, 0, len(s.lines[i]))
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+
+	return lines, nil
+}
+
+// blockAt returns the outermost sorted block which starts at a line, unless
+// we are already writing its items.
+func (s *yamlSplicer) blockAt(i int) *yamlBlock {
+	var found *yamlBlock
+	for _, b := range s.blocks[i] {
+		if !s.open[b.node] && (found == nil || b.indent < found.indent) {
+			found = b
+		}
+	}
+	return found
+}
+
+// renderBlock writes each item of a block in the place of the item that was
+// in that position. The text before the indentation of the first line comes
+// from the original line in that position, since the first item may share a
+// line with the "-" of an outer sequence.
+func (s *yamlSplicer) renderBlock(b *yamlBlock) ([]string, error) {
+	s.open[b.node] = true
+	defer delete(s.open, b.node)
+
+	items := yamlItems(b.node.Kind, b.node.Content)
+	var lines []string
+	for i, item := range items {
+		orig := b.items[b.index[item]]
+		itemLines, err := s.render(orig.start, orig.end)
+		if err != nil {
+			return nil, err
+		}
+
+		slot := b.items[i]
+		itemLines[0] = s.lines[slot.start][:b.indent] + itemLines[0][b.indent:]
+		lines = append(lines, itemLines...)
+		if i < len(items)-1 {
+			lines = append(lines, s.lines[slot.end+1:b.items[i+1].start]...)
+		}
+	}
+
+	return lines, nil
+}
+
+// renderFlows returns the text of line i from byte from up to byte to, with
+// the items of each sorted flow collection in it in their new order. A flow
+// collection can only be sorted if it's on a single line.
+func (s *yamlSplicer) renderFlows(i, from, to int) (string, error) {
+	l := s.lines[i]
+	flows := map[int]*yaml.Node{}
+	var offsets []int
+	for _, n := range s.flows[i] {
+		off := len(string([]rune(l)[:n.Column-1]))
+		if off >= from && off < to {
+			flows[off] = n
+			offsets = append(offsets, off)
+		}
+	}
+	sort.Ints(offsets)
+
+	buf := &strings.Builder{}
+	pos := from
+	for _, off := range offsets {
+		// A collection inside another one is sorted when we write the items
+		// of the outer one.
+		if off < pos {
+			continue
+		}
+
+		n := flows[off]
+		end, spans, ok := flowItemSpans(l, off)
+		orig := yamlItems(n.Kind, s.original[n])
+		if !ok || len(spans) != len(orig) {
+			return "", fmt.Errorf("the flow %s at line %d must be on a single line to be sorted", yamlKind(n), n.Line)
+		}
+		index := make(map[*yaml.Node]int, len(orig))
+		for j, item := range orig {
+			index[item] = j
+		}
+
+		buf.WriteString(l[pos:spans[0][0]])
+		items := yamlItems(n.Kind, n.Content)
+		for j, item := range items {
+			span := spans[index[item]]
+			text, err := s.renderFlows(i, span[0], span[1])
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(text)
+			if j < len(items)-1 {
+				buf.WriteString(l[spans[j][1]:spans[j+1][0]])
+			}
+		}
+		buf.WriteString(l[spans[len(spans)-1][1] : end+1])
+		pos = end + 1
+	}
+	buf.WriteString(l[pos:to])
+
+	return buf.String(), nil
+}
+
+// flowItemSpans returns the index of the bracket which closes the flow
+// collection that starts at l[open], along with the start and end of each
+// item's text, not including the whitespace around it. This returns false if
+// the collection is not closed on this line.
+func flowItemSpans(l string, open int) (int, [][2]int, bool) {
+	var spans [][2]int
+	depth := 0
+	start := open + 1
+	for i := open; i < len(l); i++ {
+		c := l[i]
+		if (c == '"' || c == '\'') && startsYAMLQuote(l, i) {
+			i = closingQuote(l, i)
+			continue
+		}
+		if c == '#' && l[i-1] == ' ' {
+			return 0, nil, false
+		}
+
+		depth += bracketDepth(c)
+		if (depth == 1 && c == ',') || depth == 0 {
+			item := strings.TrimLeft(l[start:i], " \t")
+			if text := strings.TrimRight(item, " \t"); text != "" {
+				s := i - len(item)
+				spans = append(spans, [2]int{s, s + len(text)})
+			}
+			if depth == 0 {
+				return i, spans, true
+			}
+			start = i + 1
+		}
+	}
+
+	return 0, nil, false
+}
+
+// startsYAMLQuote returns true if the quote at l[i] starts a quoted scalar
+// rather than being part of a plain one, like "it's".
+func startsYAMLQuote(l string, i int) bool {
+	prev := strings.TrimRight(l[:i], " \t")
+	return prev == "" || strings.ContainsAny(prev[len(prev)-1:], "[{,:?")
+}